@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+	"gitlab.com/slon/shad-go/distbuild/pkg/config"
+	"gitlab.com/slon/shad-go/distbuild/pkg/dist"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+	"gitlab.com/slon/shad-go/distbuild/pkg/journal"
+	"gitlab.com/slon/shad-go/distbuild/pkg/metrics"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+)
+
+const shutdownTimeout = 10 * time.Second
+
+// streamPaths are responses that last as long as the build.
+var streamPaths = map[string]bool{"/build": true, "/attach": true}
+
+// withStreamCancel cancels requests to streamPaths once streams is cancelled.
+//
+// http.Server.Shutdown waits for all active requests, and build streams would keep it
+// waiting until their builds finish.
+func withStreamCancel(streams context.Context, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !streamPaths[r.URL.Path] {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		stop := context.AfterFunc(streams, cancel)
+		defer stop()
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func main() {
+	if err := run(); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	cfg := config.DefaultCoordinator()
+	if err := config.Parse(flag.CommandLine, os.Args[1:], cfg); err != nil {
+		return err
+	}
+
+	log, err := zap.NewDevelopment()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = log.Sync() }()
+
+	serverTLS, _, token, err := cfg.Auth.Load()
+	if err != nil {
+		return err
+	}
+
+	fileCache, err := filecache.New(cfg.CacheDir)
+	if err != nil {
+		return err
+	}
+
+	coordinatorConfig := dist.Config{
+		Health: scheduler.HealthConfig{HeartbeatTimeout: cfg.HeartbeatTimeout},
+	}
+	if cfg.JournalDir != "" {
+		j, state, openErr := journal.Open(cfg.JournalDir)
+		if openErr != nil {
+			return openErr
+		}
+		defer j.Close()
+
+		coordinatorConfig.Journal = j
+		coordinatorConfig.State = state
+	}
+
+	coordinator := dist.NewCoordinatorWithConfig(log, fileCache, coordinatorConfig)
+	defer coordinator.Close()
+
+	streams, cancelStreams := context.WithCancel(context.Background())
+	defer cancelStreams()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default)
+	mux.Handle("/status", dist.NewStatusHandler(coordinator.Status))
+	mux.Handle("/trace", dist.NewTraceHandler(coordinator.Trace))
+	mux.Handle("/", withStreamCancel(streams, coordinator))
+
+	srv := &http.Server{
+		Addr:      cfg.Listen,
+		Handler:   auth.Middleware(token, mux),
+		TLSConfig: serverTLS,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			serveErr <- srv.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	log.Info("coordinator started", zap.String("listen", cfg.Listen))
+
+	select {
+	case <-ctx.Done():
+		log.Info("shutting down")
+
+		// Clients of running builds are disconnected, they can attach to the build again
+		// after the restart, see journal.
+		cancelStreams()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		err = srv.Shutdown(shutdownCtx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Warn("requests are still running, forcing shutdown")
+			return srv.Close()
+		}
+		return err
+
+	case err := <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	}
+}
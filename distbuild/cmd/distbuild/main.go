@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/client"
+	"gitlab.com/slon/shad-go/distbuild/pkg/config"
+)
+
+var errJobsFailed = errors.New("some jobs failed")
+
+func main() {
+	if err := run(); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] graph.json\n       %s [flags] -attach build-id\n", os.Args[0], os.Args[0])
+	flag.PrintDefaults()
+}
+
+func run() error {
+	var attach, traceFile string
+	flag.StringVar(&attach, "attach", "", "attach to a running build instead of starting a new one")
+	flag.StringVar(&traceFile, "trace", "", "save timeline of the build to this file in Chrome trace_event format")
+	flag.Usage = usage
+
+	cfg := config.DefaultClient()
+	if err := config.Parse(flag.CommandLine, os.Args[1:], cfg); err != nil {
+		return err
+	}
+
+	wantArgs := 1
+	if attach != "" {
+		wantArgs = 0
+	}
+
+	if flag.NArg() != wantArgs {
+		usage()
+		os.Exit(2)
+	}
+
+	_, clientTLS, token, err := cfg.Auth.Load()
+	if err != nil {
+		return err
+	}
+	httpClient := auth.NewHTTPClient(clientTLS, token)
+
+	log, err := zap.NewDevelopment()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = log.Sync() }()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	c := client.NewClientWithHTTPClient(log, cfg.Coordinator, cfg.SourceDir, httpClient)
+	p := &printer{stdout: os.Stdout, stderr: os.Stderr}
+
+	if attach != "" {
+		if err = p.buildID.UnmarshalText([]byte(attach)); err != nil {
+			return fmt.Errorf("invalid build id %q: %w", attach, err)
+		}
+
+		err = c.Attach(ctx, p.buildID, p)
+	} else {
+		var graph build.Graph
+		if graph, err = readGraph(flag.Arg(0)); err != nil {
+			return err
+		}
+
+		p.names = map[build.ID]string{}
+		for _, job := range graph.Jobs {
+			p.names[job.ID] = job.Name
+		}
+
+		err = c.Build(ctx, graph, p)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if traceFile != "" {
+		if err = saveTrace(ctx, httpClient, cfg.Coordinator, p.buildID, traceFile); err != nil {
+			return err
+		}
+	}
+
+	if p.failed != 0 {
+		return fmt.Errorf("%w: %d", errJobsFailed, p.failed)
+	}
+	return nil
+}
+
+func readGraph(path string) (build.Graph, error) {
+	var graph build.Graph
+
+	js, err := os.ReadFile(path)
+	if err != nil {
+		return graph, err
+	}
+
+	if err := json.Unmarshal(js, &graph); err != nil {
+		return graph, fmt.Errorf("invalid graph %s: %w", path, err)
+	}
+	return graph, nil
+}
+
+func saveTrace(ctx context.Context, c *http.Client, coordinator string, buildID build.ID, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, coordinator+"/trace?build_id="+buildID.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	rsp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(rsp.Body)
+		return fmt.Errorf("error fetching trace: %s", bytes.TrimSpace(msg))
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(f, rsp.Body); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// printer copies job output to the terminal and reports finished jobs on stderr.
+type printer struct {
+	stdout, stderr io.Writer
+
+	buildID build.ID
+
+	// names is nil when attached to a build, since the graph is unknown.
+	names  map[build.ID]string
+	failed int
+}
+
+func (p *printer) name(jobID build.ID) string {
+	if name, ok := p.names[jobID]; ok {
+		return name
+	}
+	return jobID.String()
+}
+
+func (p *printer) OnBuildStarted(buildID build.ID) error {
+	p.buildID = buildID
+	_, err := fmt.Fprintf(p.stderr, "build %s started\n", buildID)
+	return err
+}
+
+func (p *printer) OnJobStdout(jobID build.ID, stdout []byte) error {
+	_, err := p.stdout.Write(stdout)
+	return err
+}
+
+func (p *printer) OnJobStderr(jobID build.ID, stderr []byte) error {
+	_, err := p.stderr.Write(stderr)
+	return err
+}
+
+func (p *printer) OnJobFinished(jobID build.ID) error {
+	_, err := fmt.Fprintf(p.stderr, "job %q finished\n", p.name(jobID))
+	return err
+}
+
+func (p *printer) OnJobFailed(jobID build.ID, code int, error string) error {
+	p.failed++
+	_, err := fmt.Fprintf(p.stderr, "job %q failed with exit code %d: %s\n", p.name(jobID), code, error)
+	return err
+}
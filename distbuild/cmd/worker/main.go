@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+	"gitlab.com/slon/shad-go/distbuild/pkg/config"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+	"gitlab.com/slon/shad-go/distbuild/pkg/metrics"
+	"gitlab.com/slon/shad-go/distbuild/pkg/worker"
+)
+
+const shutdownTimeout = 10 * time.Second
+
+func main() {
+	if err := run(); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	cfg := config.DefaultWorker()
+	if err := config.Parse(flag.CommandLine, os.Args[1:], cfg); err != nil {
+		return err
+	}
+
+	log, err := zap.NewDevelopment()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = log.Sync() }()
+
+	serverTLS, clientTLS, token, err := cfg.Auth.Load()
+	if err != nil {
+		return err
+	}
+
+	fileCache, err := filecache.New(filepath.Join(cfg.CacheDir, "filecache"))
+	if err != nil {
+		return err
+	}
+
+	artifacts, err := artifact.NewCacheWithConfig(filepath.Join(cfg.CacheDir, "artifacts"), cfg.ArtifactCache())
+	if err != nil {
+		return err
+	}
+
+	w := worker.NewWithHTTPClient(api.WorkerID(cfg.Endpoint), cfg.Coordinator, log, fileCache, artifacts,
+		auth.NewHTTPClient(clientTLS, token))
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default)
+	mux.Handle("/", w)
+
+	srv := &http.Server{
+		Addr:      cfg.Listen,
+		Handler:   auth.Middleware(token, mux),
+		TLSConfig: serverTLS,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			serveErr <- srv.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- srv.ListenAndServe()
+		}
+		stop()
+	}()
+
+	log.Info("worker started", zap.String("listen", cfg.Listen), zap.String("endpoint", cfg.Endpoint))
+
+	// Run returns after SIGTERM or a failure of the HTTP server, once running jobs are stopped.
+	// Artifacts are served until then, so that other workers don't fail in the middle of a download.
+	runErr := w.Run(ctx)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	if errors.Is(runErr, context.Canceled) {
+		return nil
+	}
+	return runErr
+}
@@ -2,6 +2,7 @@ package disttest
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -10,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -18,9 +20,12 @@ import (
 
 	"gitlab.com/slon/shad-go/distbuild/pkg/api"
 	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth/authtest"
 	"gitlab.com/slon/shad-go/distbuild/pkg/client"
 	"gitlab.com/slon/shad-go/distbuild/pkg/dist"
 	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
 	"gitlab.com/slon/shad-go/distbuild/pkg/worker"
 	"gitlab.com/slon/shad-go/tools/testtool"
 
@@ -38,15 +43,69 @@ type env struct {
 	Workers     []*worker.Worker
 	WorkerCache []*artifact.Cache
 
+	// StopWorker[i] stops i-th worker, simulating a crash.
+	StopWorker []func()
+
 	HTTP *http.Server
+
+	// CA and Token are set when the cluster is secured, see Config.Secure.
+	CA    *authtest.CA
+	Token string
+
+	httpClients []*http.Client
+
+	heartbeat     chan struct{}
+	heartbeatOnce sync.Once
 }
 
 const (
 	logToStderr = true
+
+	// heartbeatTimeout is short, so that crashed workers are detected within the test timeout.
+	heartbeatTimeout = 200 * time.Millisecond
 )
 
 type Config struct {
 	WorkerCount int
+
+	// Secure enables mutual TLS and token authentication between all components.
+	Secure bool
+}
+
+// newHTTPClient creates a client for a component of the secured cluster.
+func (e *env) newHTTPClient(t *testing.T, name string) *http.Client {
+	if e.CA == nil {
+		return http.DefaultClient
+	}
+
+	cert, err := e.CA.Issue(name)
+	require.NoError(t, err)
+
+	c := auth.NewHTTPClient(auth.ClientTLSConfig(cert, e.CA.Pool()), e.Token)
+	e.httpClients = append(e.httpClients, c)
+	return c
+}
+
+// observeHeartbeats closes e.heartbeat once the coordinator has served the first heartbeat.
+func (e *env) observeHeartbeats(coordinator http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		coordinator.ServeHTTP(w, r)
+
+		if r.URL.Path == "/heartbeat" {
+			e.heartbeatOnce.Do(func() { close(e.heartbeat) })
+		}
+	})
+}
+
+// waitHeartbeat waits until the coordinator has served a heartbeat of any worker.
+func (e *env) waitHeartbeat(t *testing.T) {
+	t.Helper()
+
+	select {
+	case <-e.heartbeat:
+	case <-time.After(10 * time.Second):
+		t.Fatal("workers didn't send a heartbeat")
+	}
 }
 
 func newEnv(t *testing.T, config *Config) (e *env, cancel func()) {
@@ -69,7 +128,8 @@ func newEnv(t *testing.T, config *Config) (e *env, cancel func()) {
 	}
 
 	env := &env{
-		RootDir: rootDir,
+		RootDir:   rootDir,
+		heartbeat: make(chan struct{}),
 	}
 
 	cfg := zap.NewDevelopmentConfig()
@@ -95,26 +155,45 @@ func newEnv(t *testing.T, config *Config) (e *env, cancel func()) {
 	port, err := testtool.GetFreePort()
 	require.NoError(t, err)
 	addr := "127.0.0.1:" + port
-	coordinatorEndpoint := "http://" + addr + "/coordinator"
+
+	scheme := "http"
+	if config.Secure {
+		scheme = "https"
+		env.Token = "distbuild-test-token"
+		env.CA, err = authtest.NewCA()
+		require.NoError(t, err)
+	}
+
+	coordinatorEndpoint := scheme + "://" + addr + "/coordinator"
 
 	var cancelRootContext func()
 	env.Ctx, cancelRootContext = context.WithCancel(context.Background())
 
-	env.Client = client.NewClient(
-		env.Logger.Named("client"),
-		coordinatorEndpoint,
-		filepath.Join(absCWD, "testdata", t.Name()))
+	sourceDir := filepath.Join(absCWD, "testdata", t.Name())
+	if config.Secure {
+		env.Client = client.NewClientWithHTTPClient(
+			env.Logger.Named("client"),
+			coordinatorEndpoint,
+			sourceDir,
+			env.newHTTPClient(t, "client"))
+	} else {
+		env.Client = client.NewClient(
+			env.Logger.Named("client"),
+			coordinatorEndpoint,
+			sourceDir)
+	}
 
 	coordinatorCache, err := filecache.New(filepath.Join(env.RootDir, "coordinator", "filecache"))
 	require.NoError(t, err)
 
-	env.Coordinator = dist.NewCoordinator(
+	env.Coordinator = dist.NewCoordinatorWithConfig(
 		env.Logger.Named("coordinator"),
 		coordinatorCache,
+		dist.Config{Health: scheduler.HealthConfig{HeartbeatTimeout: heartbeatTimeout}},
 	)
 
 	router := http.NewServeMux()
-	router.Handle("/coordinator/", http.StripPrefix("/coordinator", env.Coordinator))
+	router.Handle("/coordinator/", http.StripPrefix("/coordinator", env.observeHeartbeats(env.Coordinator)))
 
 	for i := 0; i < config.WorkerCount; i++ {
 		workerName := fmt.Sprintf("worker%d", i)
@@ -129,15 +208,27 @@ func newEnv(t *testing.T, config *Config) (e *env, cancel func()) {
 		require.NoError(t, err)
 
 		workerPrefix := fmt.Sprintf("/worker/%d", i)
-		workerID := api.WorkerID("http://" + addr + workerPrefix)
-
-		w := worker.New(
-			workerID,
-			coordinatorEndpoint,
-			env.Logger.Named(workerName),
-			fileCache,
-			artifacts,
-		)
+		workerID := api.WorkerID(scheme + "://" + addr + workerPrefix)
+
+		var w *worker.Worker
+		if config.Secure {
+			w = worker.NewWithHTTPClient(
+				workerID,
+				coordinatorEndpoint,
+				env.Logger.Named(workerName),
+				fileCache,
+				artifacts,
+				env.newHTTPClient(t, workerName),
+			)
+		} else {
+			w = worker.New(
+				workerID,
+				coordinatorEndpoint,
+				env.Logger.Named(workerName),
+				fileCache,
+				artifacts,
+			)
+		}
 
 		env.Workers = append(env.Workers, w)
 		env.WorkerCache = append(env.WorkerCache, artifacts)
@@ -147,12 +238,24 @@ func newEnv(t *testing.T, config *Config) (e *env, cancel func()) {
 
 	env.HTTP = &http.Server{
 		Addr:    addr,
-		Handler: router,
+		Handler: auth.Middleware(env.Token, router),
+	}
+
+	if config.Secure {
+		var serverCert tls.Certificate
+		serverCert, err = env.CA.Issue("server", "127.0.0.1")
+		require.NoError(t, err)
+
+		env.HTTP.TLSConfig = auth.ServerTLSConfig(serverCert, env.CA.Pool())
 	}
 
 	lsn, err := net.Listen("tcp", env.HTTP.Addr)
 	require.NoError(t, err)
 
+	if config.Secure {
+		lsn = tls.NewListener(lsn, env.HTTP.TLSConfig)
+	}
+
 	go func() {
 		err := env.HTTP.Serve(lsn)
 		if err != http.ErrServerClosed {
@@ -161,8 +264,11 @@ func newEnv(t *testing.T, config *Config) (e *env, cancel func()) {
 	}()
 
 	for _, w := range env.Workers {
+		workerCtx, stopWorker := context.WithCancel(env.Ctx)
+		env.StopWorker = append(env.StopWorker, stopWorker)
+
 		go func(w *worker.Worker) {
-			err := w.Run(env.Ctx)
+			err := w.Run(workerCtx)
 			if errors.Is(err, context.Canceled) {
 				return
 			}
@@ -183,6 +289,10 @@ func newEnv(t *testing.T, config *Config) (e *env, cancel func()) {
 	return env, func() {
 		cancelRootContext()
 		_ = env.HTTP.Shutdown(context.Background())
+		env.Coordinator.Close()
+		for _, c := range env.httpClients {
+			c.CloseIdleConnections()
+		}
 		_ = env.Logger.Sync()
 
 		goleak.VerifyNone(t)
@@ -0,0 +1,56 @@
+package disttest
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+var secureConfig = &Config{WorkerCount: 2, Secure: true}
+
+func TestSecureCluster(t *testing.T) {
+	env, cancel := newEnv(t, secureConfig)
+	defer cancel()
+
+	recorder := NewRecorder()
+	require.NoError(t, env.Client.Build(env.Ctx, artifactTransferGraph, recorder))
+
+	assert.Len(t, recorder.Jobs, 2)
+	assert.Equal(t, &JobResult{Stdout: "OK", Code: new(int)}, recorder.Jobs[build.ID{'b'}])
+}
+
+func TestSecureClusterRejectsStrangers(t *testing.T) {
+	env, cancel := newEnv(t, secureConfig)
+	defer cancel()
+
+	url := "https://" + env.HTTP.Addr + "/coordinator/heartbeat"
+
+	get := func(c *http.Client) (int, error) {
+		defer c.CloseIdleConnections()
+
+		rsp, err := c.Get(url)
+		if err != nil {
+			return 0, err
+		}
+		rsp.Body.Close()
+		return rsp.StatusCode, nil
+	}
+
+	// Without client certificate the handshake fails.
+	_, err := get(auth.NewHTTPClient(&tls.Config{RootCAs: env.CA.Pool()}, env.Token))
+	require.Error(t, err)
+
+	// Valid certificate without token is rejected by the middleware.
+	cert, err := env.CA.Issue("stranger")
+	require.NoError(t, err)
+
+	code, err := get(auth.NewHTTPClient(auth.ClientTLSConfig(cert, env.CA.Pool()), ""))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, code)
+}
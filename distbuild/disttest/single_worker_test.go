@@ -1,10 +1,14 @@
 package disttest
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -135,3 +139,223 @@ func TestArtifactTransferBetweenJobs(t *testing.T) {
 	assert.Len(t, recorder.Jobs, 2)
 	assert.Equal(t, &JobResult{Stdout: "OK", Code: new(int)}, recorder.Jobs[build.ID{'b'}])
 }
+
+var cyclicGraph = build.Graph{
+	Jobs: []build.Job{
+		{
+			ID:   build.ID{'a'},
+			Name: "first",
+			Cmds: []build.Cmd{
+				{Exec: []string{"echo", "OK"}},
+			},
+			Deps: []build.ID{{'b'}},
+		},
+		{
+			ID:   build.ID{'b'},
+			Name: "second",
+			Cmds: []build.Cmd{
+				{Exec: []string{"echo", "OK"}},
+			},
+			Deps: []build.ID{{'a'}},
+		},
+	},
+}
+
+func TestInvalidGraph(t *testing.T) {
+	env, cancel := newEnv(t, singleWorkerConfig)
+	defer cancel()
+
+	recorder := NewRecorder()
+	err := env.Client.Build(env.Ctx, cyclicGraph, recorder)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "dependency cycle")
+
+	assert.Empty(t, recorder.Jobs)
+}
+
+var slowEchoGraph = build.Graph{
+	Jobs: []build.Job{
+		{
+			ID:   build.ID{'a'},
+			Name: "slow echo",
+			Cmds: []build.Cmd{
+				{Exec: []string{"sh", "-c", "echo first; sleep 2; echo second"}},
+			},
+		},
+	},
+}
+
+type timedRecorder struct {
+	*Recorder
+
+	stdoutAt   []time.Time
+	finishedAt time.Time
+}
+
+func (r *timedRecorder) OnJobStdout(jobID build.ID, stdout []byte) error {
+	r.stdoutAt = append(r.stdoutAt, time.Now())
+	return r.Recorder.OnJobStdout(jobID, stdout)
+}
+
+func (r *timedRecorder) OnJobFinished(jobID build.ID) error {
+	r.finishedAt = time.Now()
+	return r.Recorder.OnJobFinished(jobID)
+}
+
+func TestStreamingOutput(t *testing.T) {
+	env, cancel := newEnv(t, singleWorkerConfig)
+	defer cancel()
+
+	recorder := &timedRecorder{Recorder: NewRecorder()}
+	require.NoError(t, env.Client.Build(env.Ctx, slowEchoGraph, recorder))
+
+	assert.Equal(t, &JobResult{Stdout: "first\nsecond\n", Code: new(int)}, recorder.Jobs[build.ID{'a'}])
+
+	require.NotEmpty(t, recorder.stdoutAt)
+	require.Greater(t, recorder.finishedAt.Sub(recorder.stdoutAt[0]), time.Second,
+		"first line must be delivered while the job is still running")
+}
+
+func TestCancelBuild(t *testing.T) {
+	env, cancel := newEnv(t, singleWorkerConfig)
+	defer cancel()
+
+	marker := filepath.Join(env.RootDir, "marker")
+	pidFile := filepath.Join(env.RootDir, "pid")
+	graph := build.Graph{
+		Jobs: []build.Job{
+			{
+				ID:   build.ID{'a'},
+				Name: "sleep",
+				Cmds: []build.Cmd{
+					{Exec: []string{"sh", "-c", "echo $$ > " + pidFile + " && sleep 2 && touch " + marker}},
+				},
+			},
+		},
+	}
+
+	ctx, cancelBuild := context.WithCancel(env.Ctx)
+	defer cancelBuild()
+
+	buildErr := make(chan error, 1)
+	go func() { buildErr <- env.Client.Build(ctx, graph, NewRecorder()) }()
+
+	var pid int
+	require.Eventually(t, func() bool {
+		content, err := os.ReadFile(pidFile)
+		if err != nil {
+			return false
+		}
+		_, err = fmt.Sscan(string(content), &pid)
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+
+	cancelBuild()
+	require.ErrorIs(t, <-buildErr, context.Canceled)
+
+	// Job must be killed on the worker before it touches the marker.
+	require.Eventually(t, func() bool {
+		p, err := os.FindProcess(pid)
+		return err != nil || p.Signal(syscall.Signal(0)) != nil
+	}, 10*time.Second, 10*time.Millisecond)
+
+	_, err := os.Stat(marker)
+	require.Truef(t, os.IsNotExist(err), "job was not killed: %v", err)
+}
+
+var unsatisfiableGraph = build.Graph{
+	Jobs: []build.Job{
+		{
+			ID:   build.ID{'a'},
+			Name: "plan9 only",
+			Cmds: []build.Cmd{
+				{Exec: []string{"echo", "OK"}},
+			},
+			Requirements: &build.Requirements{Labels: map[string]string{"os": "plan9"}},
+		},
+	},
+}
+
+func TestUnsatisfiableRequirements(t *testing.T) {
+	env, cancel := newEnv(t, singleWorkerConfig)
+	defer cancel()
+
+	// FindWorker can't reject the job until the coordinator knows about a live worker.
+	env.waitHeartbeat(t)
+
+	recorder := NewRecorder()
+	err := env.Client.Build(env.Ctx, unsatisfiableGraph, recorder)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "os=plan9")
+
+	assert.Empty(t, recorder.Jobs)
+}
+
+type startedRecorder struct {
+	*Recorder
+
+	started  chan build.ID
+	finished chan build.ID
+}
+
+func (r *startedRecorder) OnBuildStarted(buildID build.ID) error {
+	r.started <- buildID
+	return nil
+}
+
+func (r *startedRecorder) OnJobFinished(jobID build.ID) error {
+	r.finished <- jobID
+	return r.Recorder.OnJobFinished(jobID)
+}
+
+func TestAttach(t *testing.T) {
+	env, cancel := newEnv(t, singleWorkerConfig)
+	defer cancel()
+
+	graph := build.Graph{
+		Jobs: []build.Job{
+			{
+				ID:   build.ID{'a'},
+				Name: "fast",
+				Cmds: []build.Cmd{
+					{Exec: []string{"echo", "fast"}},
+				},
+			},
+			slowEchoGraph.Jobs[0],
+		},
+	}
+	graph.Jobs[1].ID = build.ID{'b'}
+
+	recorder := &startedRecorder{
+		Recorder: NewRecorder(),
+		started:  make(chan build.ID, 1),
+		finished: make(chan build.ID, len(graph.Jobs)),
+	}
+	buildErr := make(chan error, 1)
+	go func() { buildErr <- env.Client.Build(env.Ctx, graph, recorder) }()
+
+	var buildID build.ID
+	select {
+	case buildID = <-recorder.started:
+	case err := <-buildErr:
+		t.Fatalf("build finished before start notification: %v", err)
+	}
+
+	// Let the fast job finish, so that attach has to replay it.
+	for jobID := range recorder.finished {
+		if jobID == (build.ID{'a'}) {
+			break
+		}
+	}
+
+	attached := NewRecorder()
+	require.NoError(t, env.Client.Attach(env.Ctx, buildID, attached))
+	require.NoError(t, <-buildErr)
+
+	assert.Equal(t, recorder.Jobs, attached.Jobs)
+	assert.Equal(t, &JobResult{Stdout: "fast\n", Code: new(int)}, attached.Jobs[build.ID{'a'}])
+	assert.Equal(t, &JobResult{Stdout: "first\nsecond\n", Code: new(int)}, attached.Jobs[build.ID{'b'}])
+
+	err := env.Client.Attach(env.Ctx, build.ID{'x'}, NewRecorder())
+	require.Error(t, err)
+}
@@ -3,8 +3,10 @@ package disttest
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -63,3 +65,73 @@ func TestArtifactTransferBetweenWorkers(t *testing.T) {
 		defer unlock()
 	}
 }
+
+func TestConcurrentBuildsShareJobs(t *testing.T) {
+	env, cancel := newEnv(t, threeWorkerConfig)
+	defer cancel()
+
+	counter := filepath.Join(env.RootDir, "counter")
+	graph := build.Graph{
+		Jobs: []build.Job{
+			{
+				ID:   build.ID{'a'},
+				Name: "slow",
+				Cmds: []build.Cmd{
+					// Non-hermetic, counts how many times the job was executed.
+					{Exec: []string{"sh", "-c", "echo run >> " + counter + " && sleep 1 && echo OK"}},
+				},
+			},
+		},
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	for i := 0; i < 3; i++ {
+		go func() {
+			defer wg.Done()
+
+			recorder := NewRecorder()
+			if !assert.NoError(t, env.Client.Build(env.Ctx, graph, recorder)) {
+				return
+			}
+
+			assert.Equal(t, &JobResult{Stdout: "OK\n", Code: new(int)}, recorder.Jobs[build.ID{'a'}])
+		}()
+	}
+
+	wg.Wait()
+
+	runs, err := os.ReadFile(counter)
+	require.NoError(t, err)
+	require.Equal(t, "run\n", string(runs), "job must be executed once")
+}
+
+func TestWorkerCrash(t *testing.T) {
+	env, cancel := newEnv(t, threeWorkerConfig)
+	defer cancel()
+
+	var graph build.Graph
+	for i := 0; i < 6; i++ {
+		graph.Jobs = append(graph.Jobs, build.Job{
+			ID:   build.ID{'a', byte(i)},
+			Name: fmt.Sprintf("slow %d", i),
+			Cmds: []build.Cmd{
+				{Exec: []string{"sh", "-c", "sleep 1 && echo OK"}},
+			},
+		})
+	}
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		env.StopWorker[0]()
+	}()
+
+	recorder := NewRecorder()
+	require.NoError(t, env.Client.Build(env.Ctx, graph, recorder))
+
+	require.Len(t, recorder.Jobs, len(graph.Jobs))
+	for _, job := range graph.Jobs {
+		assert.Equal(t, &JobResult{Stdout: "OK\n", Code: new(int)}, recorder.Jobs[job.ID])
+	}
+}
@@ -8,6 +8,15 @@ import (
 
 type BuildRequest struct {
 	Graph build.Graph
+
+	// Strict включает строгий режим: команды джобов видят только объявленные Inputs.
+	//
+	// Строгие джобы кешируются отдельно от обычных, см. build.MakeStrict.
+	Strict bool `json:",omitempty"`
+
+	// Priority задаёт приоритет билда. Джобы билдов с большим приоритетом выдаются воркерам раньше,
+	// билды с одинаковым приоритетом делят воркеры поровну.
+	Priority int `json:",omitempty"`
 }
 
 type BuildStarted struct {
@@ -16,6 +25,7 @@ type BuildStarted struct {
 }
 
 type StatusUpdate struct {
+	JobOutput     *JobOutput `json:",omitempty"`
 	JobFinished   *JobResult
 	BuildFailed   *BuildFailed
 	BuildFinished *BuildFinished
@@ -30,8 +40,12 @@ type BuildFinished struct {
 
 type UploadDone struct{}
 
+// Cancel отменяет билд. Джобы билда, которые нужны другим бегущим билдам, продолжают выполняться.
+type Cancel struct{}
+
 type SignalRequest struct {
 	UploadDone *UploadDone
+	Cancel     *Cancel `json:",omitempty"`
 }
 
 type SignalResponse struct {
@@ -45,6 +59,10 @@ type StatusWriter interface {
 type Service interface {
 	StartBuild(ctx context.Context, request *BuildRequest, w StatusWriter) error
 	SignalBuild(ctx context.Context, buildID build.ID, signal *SignalRequest) (*SignalResponse, error)
+
+	// AttachBuild пишет в w все сообщения о прогрессе уже идущего билда, начиная с самого первого,
+	// а затем новые сообщения по мере их появления. Метод возвращается после завершения билда.
+	AttachBuild(ctx context.Context, buildID build.ID, w StatusWriter) error
 }
 
 type StatusReader interface {
@@ -4,6 +4,7 @@ package api
 
 import (
 	"context"
+	"net/http"
 
 	"go.uber.org/zap"
 
@@ -17,6 +18,12 @@ func NewBuildClient(l *zap.Logger, endpoint string) *BuildClient {
 	panic("implement me")
 }
 
+// NewBuildClientWithHTTPClient создаёт клиента, который делает все запросы через client.
+// Так клиенту передаются сертификат и токен, см. пакет auth.
+func NewBuildClientWithHTTPClient(l *zap.Logger, endpoint string, client *http.Client) *BuildClient {
+	panic("implement me")
+}
+
 func (c *BuildClient) StartBuild(ctx context.Context, request *BuildRequest) (*BuildStarted, StatusReader, error) {
 	panic("implement me")
 }
@@ -24,3 +31,8 @@ func (c *BuildClient) StartBuild(ctx context.Context, request *BuildRequest) (*B
 func (c *BuildClient) SignalBuild(ctx context.Context, buildID build.ID, signal *SignalRequest) (*SignalResponse, error) {
 	panic("implement me")
 }
+
+// AttachBuild подключается к уже идущему билду и возвращает поток всех его сообщений о прогрессе.
+func (c *BuildClient) AttachBuild(ctx context.Context, buildID build.ID) (StatusReader, error) {
+	panic("implement me")
+}
@@ -159,3 +159,44 @@ func TestBuildResultsStreaming(t *testing.T) {
 	defer r.Close()
 	require.Equal(t, started, rsp)
 }
+
+func TestBuildAttach(t *testing.T) {
+	env, stop := newEnv(t)
+	defer stop()
+
+	ctx := context.Background()
+
+	buildIDa := build.ID{01}
+	buildIDb := build.ID{02}
+
+	finished := &api.StatusUpdate{JobFinished: &api.JobResult{ID: build.ID{03}}}
+	done := &api.StatusUpdate{BuildFinished: &api.BuildFinished{}}
+
+	env.mock.EXPECT().AttachBuild(gomock.Any(), buildIDa, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ build.ID, w api.StatusWriter) error {
+			if err := w.Updated(finished); err != nil {
+				return err
+			}
+			return w.Updated(done)
+		})
+	env.mock.EXPECT().AttachBuild(gomock.Any(), buildIDb, gomock.Any()).Return(fmt.Errorf("foo bar error"))
+
+	r, err := env.client.AttachBuild(ctx, buildIDa)
+	require.NoError(t, err)
+	defer r.Close()
+
+	u, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, finished, u)
+
+	u, err = r.Next()
+	require.NoError(t, err)
+	require.Equal(t, done, u)
+
+	_, err = r.Next()
+	require.Equal(t, io.EOF, err)
+
+	_, err = env.client.AttachBuild(ctx, buildIDb)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "foo bar error")
+}
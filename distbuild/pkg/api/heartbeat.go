@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"time"
 
 	"gitlab.com/slon/shad-go/distbuild/pkg/build"
 )
@@ -17,7 +18,53 @@ type JobResult struct {
 	// Error описывает сообщение об ошибке, из-за которого джоб не удалось выполнить.
 	//
 	// Если Error == nil, значит джоб завершился успешно.
+	//
+	// Если команда джоба превысила лимит ресурсов воркера, Error содержит текст *worker.LimitError,
+	// например "cpu limit of 1s exceeded" или "wall limit of 1m0s exceeded".
 	Error *string
+
+	// InfraError отличает ошибки воркера (не удалось скачать артефакт или исходные файлы,
+	// закончилось место на диске) от ошибок самого джоба. Такой джоб можно перезапустить
+	// на другом воркере.
+	InfraError bool `json:",omitempty"`
+
+	// Timings описывает, когда воркер выполнял фазы джоба. Координатор записывает их в трейс билда.
+	Timings *JobTimings `json:",omitempty"`
+}
+
+// JobTimings описывает время фаз джоба по часам воркера.
+type JobTimings struct {
+	// Received задаёт момент, когда воркер получил JobSpec.
+	Received time.Time
+
+	// DepsFetched задаёт момент, когда воркер скачал все артефакты зависимостей и исходные файлы.
+	DepsFetched time.Time
+
+	// Started и Finished задают начало первой и конец последней команды джоба.
+	Started  time.Time
+	Finished time.Time
+}
+
+type OutputStream string
+
+const (
+	Stdout OutputStream = "stdout"
+	Stderr OutputStream = "stderr"
+)
+
+// JobOutput описывает кусок вывода джоба, который ещё выполняется.
+type JobOutput struct {
+	ID build.ID
+
+	Stream OutputStream
+
+	// Offset задаёт смещение куска от начала потока вывода джоба.
+	//
+	// По смещению получатель упорядочивает куски и отбрасывает повторы. Полный вывод
+	// по-прежнему приходит в JobResult после завершения джоба.
+	Offset int64
+
+	Data []byte
 }
 
 type WorkerID string
@@ -41,12 +88,32 @@ type HeartbeatRequest struct {
 	// FreeSlots сообщает, сколько еще процессов можно запустить на этом воркере.
 	FreeSlots int
 
+	// FreeResources сообщает свободные ресурсы воркера в тех же единицах, что build.Job.Resources.
+	// Если поле заполнено, шедулер выдаёт воркеру только джобы, которые в них помещаются.
+	FreeResources *build.Resources `json:",omitempty"`
+
+	// Labels описывает воркер: операционную систему, архитектуру, версию тулчейна и
+	// произвольные теги. Джобы с build.Requirements выдаются только подходящим воркерам.
+	Labels map[string]string `json:",omitempty"`
+
+	// Memory сообщает полный объём памяти воркера в байтах.
+	Memory int64 `json:",omitempty"`
+
+	// CPU сообщает полное число слотов процессора воркера.
+	CPU int `json:",omitempty"`
+
 	// JobResult сообщает координатору, какие джобы завершили исполнение на этом воркере
 	// на этой итерации цикла.
 	FinishedJob []JobResult
 
 	// AddedArtifacts говорит, какие артефакты появились в кеше на этой итерации цикла.
 	AddedArtifacts []build.ID
+
+	// EvictedArtifacts говорит, какие артефакты были удалены из кеша на этой итерации цикла.
+	EvictedArtifacts []build.ID `json:",omitempty"`
+
+	// JobOutput передаёт вывод бегущих джобов, накопившийся с прошлой итерации цикла.
+	JobOutput []JobOutput `json:",omitempty"`
 }
 
 // JobSpec описывает джоб, который нужно запустить.
@@ -57,11 +124,30 @@ type JobSpec struct {
 	// Artifacts задаёт воркеров, с которых можно скачать артефакты необходимые этому джобу.
 	Artifacts map[build.ID]WorkerID
 
+	// Strict копирует BuildRequest.Strict билда, которому принадлежит джоб.
+	Strict bool `json:",omitempty"`
+
+	// BuildID и Priority задают билд, который запланировал джоб, и его приоритет.
+	// Эти поля нужны шедулеру, воркер их не использует.
+	BuildID  build.ID `json:",omitempty"`
+	Priority int      `json:",omitempty"`
+
+	// CriticalPath оценивает время от начала этого джоба до конца билда, см. build.CriticalPath.
+	CriticalPath time.Duration `json:",omitempty"`
+
 	build.Job
 }
 
 type HeartbeatResponse struct {
 	JobsToRun map[build.ID]JobSpec
+
+	// JobsToCancel перечисляет джобы, которые воркер должен прервать, убив все их процессы.
+	JobsToCancel []build.ID `json:",omitempty"`
+
+	// Resync просит воркер прислать полное состояние: все джобы в RunningJobs и все артефакты
+	// из кеша в AddedArtifacts. Координатор выставляет этот флаг в ответ на первый heartbeat
+	// воркера после своего перезапуска.
+	Resync bool `json:",omitempty"`
 }
 
 type HeartbeatService interface {
@@ -4,6 +4,7 @@ package api
 
 import (
 	"context"
+	"net/http"
 
 	"go.uber.org/zap"
 )
@@ -15,6 +16,11 @@ func NewHeartbeatClient(l *zap.Logger, endpoint string) *HeartbeatClient {
 	panic("implement me")
 }
 
+// NewHeartbeatClientWithHTTPClient создаёт клиента, который делает все запросы через client.
+func NewHeartbeatClientWithHTTPClient(l *zap.Logger, endpoint string, client *http.Client) *HeartbeatClient {
+	panic("implement me")
+}
+
 func (c *HeartbeatClient) Heartbeat(ctx context.Context, req *HeartbeatRequest) (*HeartbeatResponse, error) {
 	panic("implement me")
 }
@@ -35,6 +35,20 @@ func (m *MockService) EXPECT() *MockServiceMockRecorder {
 	return m.recorder
 }
 
+// AttachBuild mocks base method
+func (m *MockService) AttachBuild(arg0 context.Context, arg1 build.ID, arg2 api.StatusWriter) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AttachBuild", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AttachBuild indicates an expected call of AttachBuild
+func (mr *MockServiceMockRecorder) AttachBuild(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AttachBuild", reflect.TypeOf((*MockService)(nil).AttachBuild), arg0, arg1, arg2)
+}
+
 // SignalBuild mocks base method
 func (m *MockService) SignalBuild(arg0 context.Context, arg1 build.ID, arg2 *api.SignalRequest) (*api.SignalResponse, error) {
 	m.ctrl.T.Helper()
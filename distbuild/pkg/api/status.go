@@ -0,0 +1,41 @@
+package api
+
+import (
+	"time"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// WorkerStatus описывает воркер на странице статуса координатора.
+type WorkerStatus struct {
+	ID     WorkerID
+	Labels map[string]string `json:",omitempty"`
+
+	// FreeSlots, FreeResources и RunningJobs копируются из последнего heartbeat-а воркера.
+	FreeSlots     int
+	FreeResources *build.Resources `json:",omitempty"`
+	RunningJobs   []build.ID       `json:",omitempty"`
+
+	LastHeartbeat time.Time
+	Lost          bool
+	Quarantined   bool
+}
+
+// BuildStatus описывает бегущий билд на странице статуса координатора.
+type BuildStatus struct {
+	ID        build.ID
+	Priority  int
+	StartedAt time.Time
+
+	TotalJobs    int
+	FinishedJobs int
+}
+
+// ClusterStatus описывает состояние кластера, которое координатор отдаёт по /status.
+type ClusterStatus struct {
+	Workers []WorkerStatus
+	Builds  []BuildStatus
+
+	// QueueLength задаёт число джобов, которые ждут свободного воркера.
+	QueueLength int
+}
@@ -1,12 +1,16 @@
 package artifact
 
 import (
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 
 	"gitlab.com/slon/shad-go/distbuild/pkg/build"
 )
@@ -18,16 +22,50 @@ var (
 	ErrReadLocked  = errors.New("artifact is locked for read")
 )
 
+// Config задаёт ограничения на размер кеша.
+//
+// Нулевое значение поля означает, что ограничения нет.
+type Config struct {
+	// MaxSize задаёт суммарный размер файлов всех артефактов в байтах.
+	MaxSize int64
+
+	// MaxEntries задаёт максимальное число артефактов в кеше.
+	MaxEntries int
+
+	// VerifyOnGet включает проверку содержимого артефакта по манифесту при каждом вызове Get.
+	VerifyOnGet bool
+}
+
+type entry struct {
+	size       int64
+	accessTime time.Time
+}
+
 type Cache struct {
-	tmpDir   string
-	cacheDir string
+	tmpDir        string
+	cacheDir      string
+	manifestDir   string
+	quarantineDir string
+	config        Config
 
 	mu          sync.Mutex
 	writeLocked map[build.ID]struct{}
 	readLocked  map[build.ID]int
+
+	entries   map[build.ID]*entry
+	totalSize int64
+	evicted   []build.ID
 }
 
 func NewCache(root string) (*Cache, error) {
+	return NewCacheWithConfig(root, Config{})
+}
+
+// NewCacheWithConfig opens cache with size limits.
+//
+// Artifact access time is stored as mtime of the artifact directory, so eviction order survives
+// restarts. If existing artifacts exceed the limits, least recently used ones are evicted right away.
+func NewCacheWithConfig(root string, config Config) (*Cache, error) {
 	tmpDir := filepath.Join(root, "tmp")
 
 	if err := os.RemoveAll(tmpDir); err != nil {
@@ -38,23 +76,182 @@ func NewCache(root string) (*Cache, error) {
 	}
 
 	cacheDir := filepath.Join(root, "c")
-	if err := os.MkdirAll(cacheDir, 0777); err != nil {
-		return nil, err
+	manifestDir := filepath.Join(root, "m")
+	quarantineDir := filepath.Join(root, "quarantine")
+
+	for _, dir := range []string{cacheDir, manifestDir, quarantineDir} {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return nil, err
+		}
 	}
 
 	for i := 0; i < 256; i++ {
 		d := hex.EncodeToString([]byte{uint8(i)})
-		if err := os.MkdirAll(filepath.Join(cacheDir, d), 0777); err != nil {
-			return nil, err
+		for _, dir := range []string{cacheDir, manifestDir} {
+			if err := os.MkdirAll(filepath.Join(dir, d), 0777); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	c := &Cache{
+		tmpDir:        tmpDir,
+		cacheDir:      cacheDir,
+		manifestDir:   manifestDir,
+		quarantineDir: quarantineDir,
+		config:        config,
+		writeLocked:   make(map[build.ID]struct{}),
+		readLocked:    make(map[build.ID]int),
+		entries:       make(map[build.ID]*entry),
+	}
+
+	err := c.Range(func(artifact build.ID) error {
+		path := filepath.Join(c.cacheDir, artifact.Path())
+
+		st, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		size, err := dirSize(path)
+		if err != nil {
+			return err
 		}
+
+		c.entries[artifact] = &entry{size: size, accessTime: st.ModTime()}
+		c.totalSize += size
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return &Cache{
-		tmpDir:      tmpDir,
-		cacheDir:    cacheDir,
-		writeLocked: make(map[build.ID]struct{}),
-		readLocked:  make(map[build.ID]int),
-	}, nil
+	if err := c.evict(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func (c *Cache) overLimit() bool {
+	return (c.config.MaxSize > 0 && c.totalSize > c.config.MaxSize) ||
+		(c.config.MaxEntries > 0 && len(c.entries) > c.config.MaxEntries)
+}
+
+// evict removes least recently used artifacts until the cache fits into the limits.
+//
+// Artifacts that are locked for read or write are never evicted. Neither are the pinned artifacts,
+// so that freshly committed artifact is kept even if it alone exceeds the limits.
+func (c *Cache) evict(pinned ...build.ID) error {
+	c.mu.Lock()
+
+	skip := make(map[build.ID]struct{}, len(pinned))
+	for _, id := range pinned {
+		skip[id] = struct{}{}
+	}
+
+	var victims []build.ID
+	if c.overLimit() {
+		var candidates []build.ID
+		for id := range c.entries {
+			if _, ok := skip[id]; ok {
+				continue
+			}
+			if _, ok := c.writeLocked[id]; ok || c.readLocked[id] > 0 {
+				continue
+			}
+			candidates = append(candidates, id)
+		}
+
+		sort.Slice(candidates, func(i, j int) bool {
+			a, b := c.entries[candidates[i]], c.entries[candidates[j]]
+			if !a.accessTime.Equal(b.accessTime) {
+				return a.accessTime.Before(b.accessTime)
+			}
+			return bytes.Compare(candidates[i][:], candidates[j][:]) < 0
+		})
+
+		for _, id := range candidates {
+			if !c.overLimit() {
+				break
+			}
+
+			c.writeLocked[id] = struct{}{}
+			c.totalSize -= c.entries[id].size
+			delete(c.entries, id)
+			victims = append(victims, id)
+		}
+	}
+
+	c.mu.Unlock()
+
+	var errs []error
+	for _, id := range victims {
+		errs = append(errs, c.removeLocked(id))
+	}
+	return errors.Join(errs...)
+}
+
+// removeLocked removes artifact that is locked for write and releases the lock.
+//
+// Artifact is first moved into tmp directory, so that removal of large directories
+// does not block concurrent Create of the same artifact.
+func (c *Cache) removeLocked(artifact build.ID) error {
+	defer c.writeUnlock(artifact)
+
+	trash, err := os.MkdirTemp(c.tmpDir, "remove")
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(filepath.Join(c.cacheDir, artifact.Path()), filepath.Join(trash, artifact.String()))
+	if err != nil && !os.IsNotExist(err) {
+		// Artifact is still in place, so its manifest must stay too.
+		return errors.Join(err, os.RemoveAll(trash))
+	}
+
+	if removeErr := os.Remove(filepath.Join(c.manifestDir, artifact.Path())); removeErr != nil && !os.IsNotExist(removeErr) {
+		return errors.Join(removeErr, os.RemoveAll(trash))
+	}
+
+	if err == nil {
+		c.mu.Lock()
+		c.evicted = append(c.evicted, artifact)
+		c.mu.Unlock()
+	}
+
+	return os.RemoveAll(trash)
+}
+
+// Evicted returns artifacts removed from the cache since the previous call.
+//
+// Worker reports these artifacts to the coordinator in HeartbeatRequest.EvictedArtifacts.
+func (c *Cache) Evicted() []build.ID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	evicted := c.evicted
+	c.evicted = nil
+	return evicted
 }
 
 func (c *Cache) readLock(id build.ID) error {
@@ -139,9 +336,15 @@ func (c *Cache) Remove(artifact build.ID) error {
 	if err := c.writeLock(artifact, true); err != nil {
 		return err
 	}
-	defer c.writeUnlock(artifact)
 
-	return os.RemoveAll(filepath.Join(c.cacheDir, artifact.Path()))
+	c.mu.Lock()
+	if e, ok := c.entries[artifact]; ok {
+		c.totalSize -= e.size
+		delete(c.entries, artifact)
+	}
+	c.mu.Unlock()
+
+	return c.removeLocked(artifact)
 }
 
 func (c *Cache) Create(artifact build.ID) (path string, commit, abort func() error, err error) {
@@ -161,8 +364,38 @@ func (c *Cache) Create(artifact build.ID) (path string, commit, abort func() err
 	}
 
 	commit = func() error {
-		defer c.writeUnlock(artifact)
-		return os.Rename(path, filepath.Join(c.cacheDir, artifact.Path()))
+		size, err := dirSize(path)
+		if err != nil {
+			c.writeUnlock(artifact)
+			return err
+		}
+
+		m, err := BuildManifest(path)
+		if err != nil {
+			c.writeUnlock(artifact)
+			return err
+		}
+
+		if err := writeManifest(filepath.Join(c.manifestDir, artifact.Path()), m); err != nil {
+			c.writeUnlock(artifact)
+			return err
+		}
+
+		if err := os.Rename(path, filepath.Join(c.cacheDir, artifact.Path())); err != nil {
+			c.writeUnlock(artifact)
+			return err
+		}
+
+		now := time.Now()
+		_ = os.Chtimes(filepath.Join(c.cacheDir, artifact.Path()), now, now)
+
+		c.mu.Lock()
+		c.entries[artifact] = &entry{size: size, accessTime: now}
+		c.totalSize += size
+		delete(c.writeLocked, artifact)
+		c.mu.Unlock()
+
+		return c.evict(artifact)
 	}
 
 	return
@@ -183,8 +416,109 @@ func (c *Cache) Get(artifact build.ID) (path string, unlock func(), err error) {
 		return
 	}
 
+	if c.config.VerifyOnGet {
+		if err = c.verify(artifact, path); err != nil {
+			c.readUnlock(artifact)
+			if errors.Is(err, ErrCorrupted) {
+				_ = c.quarantine(artifact)
+			}
+			return
+		}
+	}
+
+	c.touch(artifact, path)
+
 	unlock = func() {
 		c.readUnlock(artifact)
 	}
 	return
 }
+
+// touch updates artifact access time both in memory and on disk.
+func (c *Cache) touch(artifact build.ID, path string) {
+	now := time.Now()
+
+	c.mu.Lock()
+	if e, ok := c.entries[artifact]; ok {
+		e.accessTime = now
+	}
+	c.mu.Unlock()
+
+	_ = os.Chtimes(path, now, now)
+}
+
+// Manifest returns manifest that was recorded when the artifact was committed.
+func (c *Cache) Manifest(artifact build.ID) (*Manifest, error) {
+	m, err := readManifest(filepath.Join(c.manifestDir, artifact.Path()))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return m, err
+}
+
+func (c *Cache) verify(artifact build.ID, path string) error {
+	m, err := c.Manifest(artifact)
+	if errors.Is(err, ErrNotFound) {
+		// Artifact was committed before manifests were introduced.
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return m.Verify(path)
+}
+
+// Verify checks content of the artifact against its manifest.
+//
+// Corrupted artifact is moved into quarantine directory and reported by Evicted,
+// so that it is never served again.
+func (c *Cache) Verify(artifact build.ID) error {
+	if err := c.readLock(artifact); err != nil {
+		return err
+	}
+
+	path := filepath.Join(c.cacheDir, artifact.Path())
+	_, err := os.Stat(path)
+	if err == nil {
+		err = c.verify(artifact, path)
+	} else if os.IsNotExist(err) {
+		err = ErrNotFound
+	}
+	c.readUnlock(artifact)
+
+	if errors.Is(err, ErrCorrupted) {
+		if qErr := c.quarantine(artifact); qErr != nil {
+			return errors.Join(err, qErr)
+		}
+	}
+	return err
+}
+
+// quarantine moves corrupted artifact out of the cache, keeping the files for investigation.
+func (c *Cache) quarantine(artifact build.ID) error {
+	if err := c.writeLock(artifact, true); err != nil {
+		return err
+	}
+	defer c.writeUnlock(artifact)
+
+	c.mu.Lock()
+	if e, ok := c.entries[artifact]; ok {
+		c.totalSize -= e.size
+		delete(c.entries, artifact)
+	}
+	c.mu.Unlock()
+
+	dst := filepath.Join(c.quarantineDir, fmt.Sprintf("%s-%d", artifact, time.Now().UnixNano()))
+	if err := os.Rename(filepath.Join(c.cacheDir, artifact.Path()), dst); err != nil {
+		return err
+	}
+
+	if err := os.Rename(filepath.Join(c.manifestDir, artifact.Path()), dst+".manifest"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	c.mu.Lock()
+	c.evicted = append(c.evicted, artifact)
+	c.mu.Unlock()
+	return nil
+}
@@ -96,3 +96,71 @@ func TestArtifactExists(t *testing.T) {
 	_, _, _, err = c.Create(idA)
 	require.Truef(t, errors.Is(err, artifact.ErrExists), "%v", err)
 }
+
+func createArtifact(t *testing.T, c *artifact.Cache, id build.ID, size int) {
+	t.Helper()
+
+	path, commit, _, err := c.Create(id)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(path, "a.txt"), make([]byte, size), 0666))
+	require.NoError(t, commit())
+}
+
+func TestEviction(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	c, err := artifact.NewCacheWithConfig(tmpDir, artifact.Config{MaxEntries: 2})
+	require.NoError(t, err)
+
+	idA, idB, idC, idD := build.ID{'a'}, build.ID{'b'}, build.ID{'c'}, build.ID{'d'}
+
+	createArtifact(t, c, idA, 1)
+	createArtifact(t, c, idB, 1)
+
+	_, unlock, err := c.Get(idA)
+	require.NoError(t, err)
+	unlock()
+
+	createArtifact(t, c, idC, 1)
+	require.Equal(t, []build.ID{idB}, c.Evicted())
+	require.Empty(t, c.Evicted())
+
+	_, _, err = c.Get(idB)
+	require.Truef(t, errors.Is(err, artifact.ErrNotFound), "%v", err)
+
+	_, unlockA, err := c.Get(idA)
+	require.NoError(t, err)
+
+	_, unlock, err = c.Get(idC)
+	require.NoError(t, err)
+	unlock()
+
+	createArtifact(t, c, idD, 1)
+	require.Equal(t, []build.ID{idC}, c.Evicted())
+	unlockA()
+
+	c, err = artifact.NewCacheWithConfig(tmpDir, artifact.Config{MaxEntries: 1})
+	require.NoError(t, err)
+	require.Equal(t, []build.ID{idA}, c.Evicted())
+
+	_, unlock, err = c.Get(idD)
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestEvictionBySize(t *testing.T) {
+	c, err := artifact.NewCacheWithConfig(t.TempDir(), artifact.Config{MaxSize: 100})
+	require.NoError(t, err)
+
+	idA, idB, idC := build.ID{'a'}, build.ID{'b'}, build.ID{'c'}
+
+	createArtifact(t, c, idA, 40)
+	createArtifact(t, c, idB, 40)
+	require.Empty(t, c.Evicted())
+
+	createArtifact(t, c, idC, 40)
+	require.Equal(t, []build.ID{idA}, c.Evicted())
+
+	createArtifact(t, c, build.ID{'d'}, 200)
+	require.ElementsMatch(t, []build.ID{idB, idC}, c.Evicted())
+}
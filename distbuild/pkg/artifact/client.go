@@ -4,6 +4,7 @@ package artifact
 
 import (
 	"context"
+	"net/http"
 
 	"gitlab.com/slon/shad-go/distbuild/pkg/build"
 )
@@ -12,3 +13,8 @@ import (
 func Download(ctx context.Context, endpoint string, c *Cache, artifactID build.ID) error {
 	panic("implement me")
 }
+
+// DownloadWithHTTPClient работает так же, как Download, но делает запросы через client.
+func DownloadWithHTTPClient(ctx context.Context, client *http.Client, endpoint string, c *Cache, artifactID build.ID) error {
+	panic("implement me")
+}
@@ -1,11 +1,15 @@
 package artifact_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -49,3 +53,191 @@ func TestArtifactTransfer(t *testing.T) {
 	err = artifact.Download(ctx, server.URL, localCache.Cache, build.ID{0x02})
 	require.Error(t, err)
 }
+
+func newTransferEnv(t *testing.T, size int) (remote, local *testCache, id build.ID, content []byte) {
+	remote = newTestCache(t)
+	local = newTestCache(t)
+
+	id = build.ID{0x01}
+	content = make([]byte, size)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	dir, commit, _, err := remote.Create(id)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.bin"), content, 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), bytes.Repeat([]byte("foobar"), 1024*1024), 0666))
+	require.NoError(t, commit())
+	return
+}
+
+func checkTransferred(t *testing.T, local *testCache, id build.ID, content []byte) {
+	t.Helper()
+
+	dir, unlock, err := local.Get(id)
+	require.NoError(t, err)
+	defer unlock()
+
+	actual, err := os.ReadFile(filepath.Join(dir, "a.bin"))
+	require.NoError(t, err)
+	require.Equal(t, content, actual)
+}
+
+func TestArtifactTransferCompressed(t *testing.T) {
+	remote, local, id, content := newTransferEnv(t, 1024)
+
+	mux := http.NewServeMux()
+	artifact.NewHandler(zaptest.NewLogger(t), remote.Cache).Register(mux)
+
+	recorder := &encodingRecorder{next: mux}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	require.NoError(t, artifact.Download(context.Background(), server.URL, local.Cache, id))
+	checkTransferred(t, local, id, content)
+
+	require.Equal(t, []string{"gzip"}, recorder.Encodings())
+}
+
+func TestArtifactRangeRequest(t *testing.T) {
+	remote, _, id, _ := newTransferEnv(t, 1024)
+
+	mux := http.NewServeMux()
+	artifact.NewHandler(zaptest.NewLogger(t), remote.Cache).Register(mux)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(rangeHeader string) (int, []byte) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/artifact?id="+id.String(), nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept-Encoding", "identity")
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+
+		rsp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer rsp.Body.Close()
+
+		body, err := io.ReadAll(rsp.Body)
+		require.NoError(t, err)
+		return rsp.StatusCode, body
+	}
+
+	code, full := get("")
+	require.Equal(t, http.StatusOK, code)
+
+	code, tail := get("bytes=1000-")
+	require.Equal(t, http.StatusPartialContent, code)
+	require.Equal(t, full[1000:], tail)
+}
+
+// encodingRecorder records Content-Encoding of every response before the response is sent.
+type encodingRecorder struct {
+	next http.Handler
+
+	mu        sync.Mutex
+	encodings []string
+}
+
+func (h *encodingRecorder) Encodings() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.encodings...)
+}
+
+type recordingWriter struct {
+	http.ResponseWriter
+	record func(http.Header)
+	once   sync.Once
+}
+
+func (w *recordingWriter) WriteHeader(code int) {
+	w.once.Do(func() { w.record(w.Header()) })
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { w.record(w.Header()) })
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (h *encodingRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.next.ServeHTTP(&recordingWriter{
+		ResponseWriter: w,
+		record: func(header http.Header) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.encodings = append(h.encodings, header.Get("Content-Encoding"))
+		},
+	}, r)
+}
+
+// flakyHandler drops connection of the first request after limit bytes of the body were sent.
+type flakyHandler struct {
+	next  http.Handler
+	limit int
+
+	mu       sync.Mutex
+	requests int
+	ranges   []string
+}
+
+type limitedWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		_, _ = w.ResponseWriter.Write(p[:w.limit])
+		_ = http.NewResponseController(w.ResponseWriter).Flush()
+		panic(http.ErrAbortHandler)
+	}
+
+	w.limit -= len(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (h *flakyHandler) Ranges() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.ranges...)
+}
+
+func (h *flakyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.requests++
+	first := h.requests == 1
+	h.ranges = append(h.ranges, r.Header.Get("Range"))
+	h.mu.Unlock()
+
+	if first {
+		w = &limitedWriter{ResponseWriter: w, limit: h.limit}
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+func TestArtifactTransferResume(t *testing.T) {
+	remote, local, id, content := newTransferEnv(t, 4*1024*1024)
+
+	mux := http.NewServeMux()
+	artifact.NewHandler(zaptest.NewLogger(t), remote.Cache).Register(mux)
+
+	flaky := &flakyHandler{next: mux, limit: 1024 * 1024}
+	server := httptest.NewServer(flaky)
+	defer server.Close()
+
+	require.NoError(t, artifact.Download(context.Background(), server.URL, local.Cache, id))
+	checkTransferred(t, local, id, content)
+
+	ranges := flaky.Ranges()
+	require.GreaterOrEqual(t, len(ranges), 2)
+	require.Empty(t, ranges[0])
+	require.Regexp(t, `^bytes=[1-9][0-9]*-$`, ranges[1])
+}
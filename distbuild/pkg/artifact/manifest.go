@@ -0,0 +1,175 @@
+package artifact
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+var ErrCorrupted = errors.New("artifact is corrupted")
+
+// ManifestEntry описывает один файл или директорию внутри артефакта.
+type ManifestEntry struct {
+	// Path задаёт путь относительно корня артефакта.
+	Path string
+
+	Mode fs.FileMode
+
+	// Size и Hash заполнены только для обычных файлов.
+	Size int64
+	Hash build.ID `json:",omitempty"`
+
+	// Link задаёт путь, на который указывает символическая ссылка.
+	Link string `json:",omitempty"`
+}
+
+// Manifest перечисляет содержимое артефакта.
+type Manifest struct {
+	Entries []ManifestEntry
+}
+
+func hashFile(path string) (build.ID, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return build.ID{}, err
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return build.ID{}, err
+	}
+
+	var id build.ID
+	copy(id[:], h.Sum(nil))
+	return id, nil
+}
+
+// BuildManifest walks dir and records path, mode and content hash of every entry.
+func BuildManifest(dir string) (*Manifest, error) {
+	m := &Manifest{}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if rel == "." {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		e := ManifestEntry{Path: filepath.ToSlash(rel), Mode: info.Mode()}
+		switch {
+		case info.Mode().IsRegular():
+			e.Size = info.Size()
+			if e.Hash, err = hashFile(path); err != nil {
+				return err
+			}
+
+		case info.Mode()&fs.ModeSymlink != 0:
+			if e.Link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		m.Entries = append(m.Entries, e)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func sameMode(a, b fs.FileMode) bool {
+	// Permission bits other than executable depend on umask of the receiving side.
+	return a.Type() == b.Type() && (a&0111 != 0) == (b&0111 != 0)
+}
+
+// Verify checks that content of dir matches the manifest.
+//
+// File modes are compared up to the executable bit. Mismatch is reported as ErrCorrupted.
+func (m *Manifest) Verify(dir string) error {
+	actual, err := BuildManifest(dir)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+
+	entries := make(map[string]ManifestEntry, len(actual.Entries))
+	for _, e := range actual.Entries {
+		entries[e.Path] = e
+	}
+
+	for _, expected := range m.Entries {
+		e, ok := entries[expected.Path]
+		switch {
+		case !ok:
+			return fmt.Errorf("%w: %s is missing", ErrCorrupted, expected.Path)
+		case !sameMode(expected.Mode, e.Mode):
+			return fmt.Errorf("%w: %s has mode %v, expected %v", ErrCorrupted, expected.Path, e.Mode, expected.Mode)
+		case expected.Size != e.Size || expected.Hash != e.Hash:
+			return fmt.Errorf("%w: %s content mismatch", ErrCorrupted, expected.Path)
+		case expected.Link != e.Link:
+			return fmt.Errorf("%w: %s points to %q, expected %q", ErrCorrupted, expected.Path, e.Link, expected.Link)
+		}
+
+		delete(entries, expected.Path)
+	}
+
+	if len(entries) != 0 {
+		var unexpected []string
+		for path := range entries {
+			unexpected = append(unexpected, path)
+		}
+		sort.Strings(unexpected)
+
+		return fmt.Errorf("%w: unexpected files %v", ErrCorrupted, unexpected)
+	}
+
+	return nil
+}
+
+func writeManifest(path string, m *Manifest) error {
+	js, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, js, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readManifest(path string) (*Manifest, error) {
+	js, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(js, &m); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %v", ErrCorrupted, err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,103 @@
+package artifact_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/tarstream"
+)
+
+func createTree(t *testing.T, c *artifact.Cache, id build.ID) string {
+	t.Helper()
+
+	path, commit, _, err := c.Create(id)
+	require.NoError(t, err)
+	require.NoError(t, os.Mkdir(filepath.Join(path, "bin"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(path, "bin", "tool"), []byte("#!/bin/sh"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(path, "a.txt"), []byte("foobar"), 0644))
+	require.NoError(t, commit())
+
+	path, unlock, err := c.Get(id)
+	require.NoError(t, err)
+	unlock()
+	return path
+}
+
+func TestManifest(t *testing.T) {
+	c := newTestCache(t)
+	id := build.ID{'a'}
+
+	path := createTree(t, c.Cache, id)
+
+	m, err := c.Manifest(id)
+	require.NoError(t, err)
+	require.Len(t, m.Entries, 3)
+	require.NoError(t, m.Verify(path))
+	require.NoError(t, c.Verify(id))
+
+	_, err = c.Manifest(build.ID{'b'})
+	require.Truef(t, errors.Is(err, artifact.ErrNotFound), "%v", err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(path, "a.txt"), []byte("foobaz"), 0644))
+
+	err = c.Verify(id)
+	require.Truef(t, errors.Is(err, artifact.ErrCorrupted), "%v", err)
+	require.Equal(t, []build.ID{id}, c.Evicted())
+
+	_, _, err = c.Get(id)
+	require.Truef(t, errors.Is(err, artifact.ErrNotFound), "%v", err)
+
+	quarantined, err := os.ReadDir(filepath.Join(c.tmpDir, "quarantine"))
+	require.NoError(t, err)
+	require.Len(t, quarantined, 2)
+
+	createTree(t, c.Cache, id)
+}
+
+func TestVerifyOnGet(t *testing.T) {
+	c, err := artifact.NewCacheWithConfig(t.TempDir(), artifact.Config{VerifyOnGet: true})
+	require.NoError(t, err)
+
+	id := build.ID{'a'}
+	path := createTree(t, c, id)
+
+	require.NoError(t, os.Chmod(filepath.Join(path, "bin", "tool"), 0644))
+
+	_, _, err = c.Get(id)
+	require.Truef(t, errors.Is(err, artifact.ErrCorrupted), "%v", err)
+	require.Equal(t, []build.ID{id}, c.Evicted())
+
+	_, _, err = c.Get(id)
+	require.Truef(t, errors.Is(err, artifact.ErrNotFound), "%v", err)
+}
+
+func TestManifestTransfer(t *testing.T) {
+	c := newTestCache(t)
+	id := build.ID{'a'}
+
+	path := createTree(t, c.Cache, id)
+
+	m, err := c.Manifest(id)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, tarstream.Send(path, &buf))
+	stream := buf.Bytes()
+
+	to := t.TempDir()
+	require.NoError(t, tarstream.Receive(to, bytes.NewReader(stream)))
+	require.NoError(t, m.Verify(to))
+
+	truncated := t.TempDir()
+	_ = tarstream.Receive(truncated, bytes.NewReader(stream[:len(stream)/2]))
+
+	err = m.Verify(truncated)
+	require.Truef(t, errors.Is(err, artifact.ErrCorrupted), "%v", err)
+}
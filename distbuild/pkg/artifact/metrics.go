@@ -0,0 +1,10 @@
+package artifact
+
+import "gitlab.com/slon/shad-go/distbuild/pkg/metrics"
+
+var (
+	downloadedBytes = metrics.Default.Counter("distbuild_artifact_download_bytes_total",
+		"Bytes of artifacts received by Download.")
+	servedBytes = metrics.Default.Counter("distbuild_artifact_served_bytes_total",
+		"Bytes of artifacts sent by Handler.")
+)
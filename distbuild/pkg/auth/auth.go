@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var ErrUnauthorized = errors.New("unauthorized")
+
+const bearerPrefix = "Bearer "
+
+// Middleware пропускает в next только запросы с заголовком "Authorization: Bearer <token>".
+//
+// Остальные запросы получают ответ 401. Пустой token отключает проверку.
+func Middleware(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), bearerPrefix)
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tokenTransport adds the shared token to every request.
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTripper must not modify the original request.
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", bearerPrefix+t.token)
+	return t.base.RoundTrip(req)
+}
+
+// NewHTTPClient создаёт клиента, который предъявляет сертификат из tlsConfig и добавляет token
+// в каждый запрос.
+//
+// Оба параметра опциональны. Без них NewHTTPClient возвращает http.DefaultClient.
+func NewHTTPClient(tlsConfig *tls.Config, token string) *http.Client {
+	if tlsConfig == nil && token == "" {
+		return http.DefaultClient
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	var rt http.RoundTripper = transport
+	if token != "" {
+		rt = &tokenTransport{token: token, base: transport}
+	}
+	return &http.Client{Transport: rt}
+}
+
+// ServerTLSConfig создаёт конфиг сервера, который требует от клиента сертификат, подписанный ca.
+func ServerTLSConfig(cert tls.Certificate, ca *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    ca,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// ClientTLSConfig создаёт конфиг клиента, который предъявляет cert и доверяет только серверам,
+// сертификат которых подписан ca.
+func ClientTLSConfig(cert tls.Certificate, ca *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      ca,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// Files описывает, где лежат ключи и сертификаты компонента.
+type Files struct {
+	// CertFile и KeyFile задают сертификат компонента и его ключ в формате PEM. Один и тот же сертификат
+	// используется и как серверный, и как клиентский.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+
+	// CAFile задаёт сертификат CA в формате PEM, которым подписаны сертификаты всех компонентов.
+	CAFile string `yaml:"ca_file"`
+
+	// TokenFile задаёт файл с общим токеном.
+	TokenFile string `yaml:"token_file"`
+}
+
+func (f *Files) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&f.CertFile, "cert-file", f.CertFile, "PEM certificate of this component, enables mutual TLS")
+	fs.StringVar(&f.KeyFile, "key-file", f.KeyFile, "PEM private key of the certificate")
+	fs.StringVar(&f.CAFile, "ca-file", f.CAFile, "PEM certificate of the CA that signs certificates of all components")
+	fs.StringVar(&f.TokenFile, "token-file", f.TokenFile, "file with the shared token, enables token authentication")
+}
+
+// Load читает файлы и возвращает конфиги TLS сервера и клиента и токен.
+//
+// Если CertFile не задан, TLS выключен и оба конфига равны nil. Если не задан TokenFile, токен пустой.
+func (f *Files) Load() (server, client *tls.Config, token string, err error) {
+	if f.TokenFile != "" {
+		b, readErr := os.ReadFile(f.TokenFile)
+		if readErr != nil {
+			return nil, nil, "", readErr
+		}
+
+		token = strings.TrimSpace(string(b))
+		if token == "" {
+			return nil, nil, "", fmt.Errorf("token file %s is empty", f.TokenFile)
+		}
+	}
+
+	if f.CertFile == "" {
+		return nil, nil, token, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	caPEM, err := os.ReadFile(f.CAFile)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	ca := x509.NewCertPool()
+	if !ca.AppendCertsFromPEM(caPEM) {
+		return nil, nil, "", fmt.Errorf("no certificates found in %s", f.CAFile)
+	}
+
+	return ServerTLSConfig(cert, ca), ClientTLSConfig(cert, ca), token, nil
+}
@@ -0,0 +1,136 @@
+package auth_test
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth/authtest"
+)
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("OK"))
+})
+
+func get(t *testing.T, c *http.Client, url string) int {
+	t.Helper()
+
+	rsp, err := c.Get(url)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	_, err = io.Copy(io.Discard, rsp.Body)
+	require.NoError(t, err)
+	return rsp.StatusCode
+}
+
+func TestToken(t *testing.T) {
+	server := httptest.NewServer(auth.Middleware("secret", ok))
+	defer server.Close()
+
+	require.Equal(t, http.StatusOK, get(t, auth.NewHTTPClient(nil, "secret"), server.URL))
+	require.Equal(t, http.StatusUnauthorized, get(t, auth.NewHTTPClient(nil, "wrong"), server.URL))
+	require.Equal(t, http.StatusUnauthorized, get(t, http.DefaultClient, server.URL))
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "secret")
+
+	rsp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, rsp.StatusCode, "Bearer prefix is required")
+}
+
+func TestNoToken(t *testing.T) {
+	server := httptest.NewServer(auth.Middleware("", ok))
+	defer server.Close()
+
+	require.Same(t, http.DefaultClient, auth.NewHTTPClient(nil, ""))
+	require.Equal(t, http.StatusOK, get(t, http.DefaultClient, server.URL))
+}
+
+func newTLSServer(t *testing.T, ca *authtest.CA) *httptest.Server {
+	cert, err := ca.Issue("server", "127.0.0.1")
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(ok)
+	server.TLS = auth.ServerTLSConfig(cert, ca.Pool())
+	server.StartTLS()
+	return server
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca, err := authtest.NewCA()
+	require.NoError(t, err)
+
+	server := newTLSServer(t, ca)
+	defer server.Close()
+
+	cert, err := ca.Issue("client")
+	require.NoError(t, err)
+
+	c := auth.NewHTTPClient(auth.ClientTLSConfig(cert, ca.Pool()), "")
+	require.Equal(t, http.StatusOK, get(t, c, server.URL))
+
+	// Client without certificate is rejected during handshake.
+	noCert := auth.NewHTTPClient(&tls.Config{RootCAs: ca.Pool()}, "")
+	_, err = noCert.Get(server.URL)
+	require.Error(t, err)
+
+	// Certificate signed by another CA is rejected as well.
+	otherCA, err := authtest.NewCA()
+	require.NoError(t, err)
+	otherCert, err := otherCA.Issue("client")
+	require.NoError(t, err)
+
+	_, err = auth.NewHTTPClient(auth.ClientTLSConfig(otherCert, ca.Pool()), "").Get(server.URL)
+	require.Error(t, err)
+
+	// Client doesn't trust the server signed by unknown CA.
+	_, err = auth.NewHTTPClient(auth.ClientTLSConfig(otherCert, otherCA.Pool()), "").Get(server.URL)
+	require.Error(t, err)
+}
+
+func TestFilesLoad(t *testing.T) {
+	ca, err := authtest.NewCA()
+	require.NoError(t, err)
+
+	server := newTLSServer(t, ca)
+	defer server.Close()
+
+	cert, err := ca.Issue("client")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile, caFile, err := ca.WriteFiles(dir, cert)
+	require.NoError(t, err)
+
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0600))
+
+	files := &auth.Files{CertFile: certFile, KeyFile: keyFile, CAFile: caFile, TokenFile: tokenFile}
+	serverTLS, clientTLS, token, err := files.Load()
+	require.NoError(t, err)
+	require.NotNil(t, serverTLS)
+	require.Equal(t, "secret", token)
+
+	require.Equal(t, http.StatusOK, get(t, auth.NewHTTPClient(clientTLS, token), server.URL))
+
+	serverTLS, clientTLS, token, err = (&auth.Files{}).Load()
+	require.NoError(t, err)
+	require.Nil(t, serverTLS)
+	require.Nil(t, clientTLS)
+	require.Empty(t, token)
+
+	require.NoError(t, os.WriteFile(tokenFile, nil, 0600))
+	_, _, _, err = (&auth.Files{TokenFile: tokenFile}).Load()
+	require.Error(t, err)
+}
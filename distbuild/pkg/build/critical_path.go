@@ -0,0 +1,34 @@
+package build
+
+import "time"
+
+// CriticalPath оценивает, сколько времени осталось до конца сборки после начала каждого джоба.
+//
+// Для каждого джоба вычисляется длина самой длинной цепочки, которая начинается в этом джобе
+// и идёт по зависимым от него джобам. Длина цепочки - сумма оценок estimate всех джобов цепочки,
+// включая сам джоб. Джобы с большей длиной стоит запускать раньше.
+//
+// Граф должен быть ацикличным, см. Graph.Validate.
+func CriticalPath(jobs []Job, estimate func(job *Job) time.Duration) map[ID]time.Duration {
+	sorted := TopSort(jobs)
+	remaining := make(map[ID]time.Duration, len(sorted))
+
+	// tail[id] is the longest chain among jobs that depend on id.
+	tail := make(map[ID]time.Duration, len(sorted))
+
+	// Reverse topological order visits all dependents of a job before the job itself.
+	for i := len(sorted) - 1; i >= 0; i-- {
+		job := &sorted[i]
+
+		length := estimate(job) + tail[job.ID]
+		remaining[job.ID] = length
+
+		for _, dep := range job.Deps {
+			if length > tail[dep] {
+				tail[dep] = length
+			}
+		}
+	}
+
+	return remaining
+}
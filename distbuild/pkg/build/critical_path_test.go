@@ -0,0 +1,40 @@
+package build
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCriticalPath(t *testing.T) {
+	// compile a -> link -> test
+	//           \-> vet
+	jobs := []Job{
+		{ID: ID{'v'}, Name: "vet", Deps: []ID{{'a'}}},
+		{ID: ID{'t'}, Name: "test", Deps: []ID{{'l'}}},
+		{ID: ID{'l'}, Name: "link", Deps: []ID{{'a'}}},
+		{ID: ID{'a'}, Name: "compile"},
+		{ID: ID{'x'}, Name: "unrelated"},
+	}
+
+	durations := map[string]time.Duration{
+		"compile":   time.Second,
+		"link":      5 * time.Second,
+		"test":      10 * time.Second,
+		"vet":       2 * time.Second,
+		"unrelated": 3 * time.Second,
+	}
+
+	remaining := CriticalPath(jobs, func(job *Job) time.Duration {
+		return durations[job.Name]
+	})
+
+	require.Equal(t, map[ID]time.Duration{
+		{'a'}: 16 * time.Second,
+		{'l'}: 15 * time.Second,
+		{'t'}: 10 * time.Second,
+		{'v'}: 2 * time.Second,
+		{'x'}: 3 * time.Second,
+	}, remaining)
+}
@@ -29,6 +29,29 @@ type Job struct {
 
 	// Cmds описывает список команд, которые нужно выполнить в рамках этого джоба.
 	Cmds []Cmd
+
+	// Outputs задаёт список файлов и директорий внутри OutputDir, которые производит джоб.
+	//
+	// Если список задан, воркер завершает джоб с ошибкой, когда объявленного выхода нет
+	// или в OutputDir появился необъявленный файл. Пустой список отключает проверку.
+	Outputs []string `json:",omitempty"`
+
+	// Requirements задаёт, на каких воркерах может выполняться джоб.
+	Requirements *Requirements `json:",omitempty"`
+
+	// Resources задаёт, сколько ресурсов воркера занимает джоб. По умолчанию джоб
+	// занимает один слот процессора, см. Job.Cost.
+	Resources *Resources `json:",omitempty"`
+}
+
+// Requirements описывает требования джоба к воркеру.
+type Requirements struct {
+	// Labels перечисляет метки, которые должны быть у воркера. Например, "os": "linux"
+	// или "go": "go1.22.0". Пустое значение требует только наличия метки.
+	Labels map[string]string `json:",omitempty"`
+
+	// Memory задаёт минимальный объём памяти воркера в байтах.
+	Memory int64 `json:",omitempty"`
 }
 
 // Cmd описывает одну команду сборки.
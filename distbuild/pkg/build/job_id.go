@@ -0,0 +1,253 @@
+package build
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+)
+
+// jobHasher вычисляет ID джобов по их содержимому.
+//
+// ID джоба - это sha1 от входных файлов (путей и хешей содержимого из Graph.SourceFiles), команд
+// и ID зависимостей. Имя джоба в хеш не входит. Resources тоже не входит: это оценка для планировщика,
+// от неё не зависит результат джоба, и уточнение оценки не должно инвалидировать кеш.
+type jobHasher struct {
+	inputs map[string]ID
+}
+
+func newJobHasher(sourceFiles map[ID]string) *jobHasher {
+	h := &jobHasher{inputs: make(map[string]ID, len(sourceFiles))}
+	for id, path := range sourceFiles {
+		h.inputs[path] = id
+	}
+	return h
+}
+
+func writeSize(h hash.Hash, n int) {
+	var size [binary.MaxVarintLen64]byte
+	_, _ = h.Write(size[:binary.PutUvarint(size[:], uint64(n))])
+}
+
+func writeString(h hash.Hash, s string) {
+	writeSize(h, len(s))
+	_, _ = h.Write([]byte(s))
+}
+
+func writeList(h hash.Hash, l []string) {
+	writeSize(h, len(l))
+	for _, s := range l {
+		writeString(h, s)
+	}
+}
+
+func (jh *jobHasher) jobID(job *Job) (ID, error) {
+	h := sha1.New()
+
+	inputs := append([]string(nil), job.Inputs...)
+	sort.Strings(inputs)
+
+	writeString(h, "inputs")
+	writeList(h, inputs)
+	for _, path := range inputs {
+		fileID, ok := jh.inputs[path]
+		if !ok {
+			return ID{}, fmt.Errorf("job %q: input %q is missing from source files", job.Name, path)
+		}
+		_, _ = h.Write(fileID[:])
+	}
+
+	// Зависимости хешируются в порядке ID, чтобы ID джоба не зависел от порядка Job.Deps.
+	deps := append([]ID(nil), job.Deps...)
+	sort.Slice(deps, func(i, j int) bool {
+		return bytes.Compare(deps[i][:], deps[j][:]) < 0
+	})
+
+	writeString(h, "deps")
+	writeSize(h, len(deps))
+	for _, dep := range deps {
+		_, _ = h.Write(dep[:])
+	}
+
+	writeString(h, "cmds")
+	writeSize(h, len(job.Cmds))
+	for _, cmd := range job.Cmds {
+		writeList(h, cmd.Exec)
+		writeList(h, cmd.Environ)
+		writeString(h, cmd.WorkingDirectory)
+		writeString(h, cmd.CatTemplate)
+		writeString(h, cmd.CatOutput)
+	}
+
+	// Optional fields are hashed only when set, so that IDs of jobs that don't use them stay the same.
+	if len(job.Outputs) != 0 {
+		outputs := append([]string(nil), job.Outputs...)
+		sort.Strings(outputs)
+
+		writeString(h, "outputs")
+		writeList(h, outputs)
+	}
+
+	if r := job.Requirements; r != nil {
+		labels := make([]string, 0, len(r.Labels))
+		for name, value := range r.Labels {
+			labels = append(labels, name+"="+value)
+		}
+		sort.Strings(labels)
+
+		writeString(h, "requirements")
+		writeList(h, labels)
+		writeString(h, fmt.Sprint(r.Memory))
+	}
+
+	var id ID
+	copy(id[:], h.Sum(nil))
+	return id, nil
+}
+
+// JobID вычисляет ID джоба по его содержимому.
+//
+// ID зависимостей джоба уже должны быть вычислены.
+func JobID(job *Job, sourceFiles map[ID]string) (ID, error) {
+	return newJobHasher(sourceFiles).jobID(job)
+}
+
+func indexJobs(g *Graph) (map[ID]int, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+
+	index := make(map[ID]int, len(g.Jobs))
+	for i, job := range g.Jobs {
+		index[job.ID] = i
+	}
+	return index, nil
+}
+
+// renameDeps rewrites Deps of the job and dependency references inside its Cmds.
+func renameDeps(job *Job, renamed map[ID]ID) {
+	var replace []string
+	deps := make([]ID, len(job.Deps))
+	for j, dep := range job.Deps {
+		deps[j] = renamed[dep]
+		replace = append(replace, dep.String(), deps[j].String())
+	}
+	job.Deps = deps
+
+	r := strings.NewReplacer(replace...)
+	renameList := func(l []string) []string {
+		var result []string
+		for _, s := range l {
+			result = append(result, r.Replace(s))
+		}
+		return result
+	}
+
+	cmds := make([]Cmd, len(job.Cmds))
+	for j, cmd := range job.Cmds {
+		cmds[j] = Cmd{
+			Exec:             renameList(cmd.Exec),
+			Environ:          renameList(cmd.Environ),
+			WorkingDirectory: r.Replace(cmd.WorkingDirectory),
+			CatTemplate:      r.Replace(cmd.CatTemplate),
+			CatOutput:        r.Replace(cmd.CatOutput),
+		}
+	}
+	job.Cmds = cmds
+}
+
+// AssignIDs заменяет ID джобов на ID, вычисленные по содержимому.
+//
+// До вызова ID джобов служат только уникальными ссылками между джобами. AssignIDs обходит граф
+// в топологическом порядке, вычисляет ID каждого джоба и переписывает Deps и ссылки на зависимости
+// внутри Cmds на новые ID.
+func AssignIDs(g *Graph) error {
+	index, err := indexJobs(g)
+	if err != nil {
+		return err
+	}
+
+	jh := newJobHasher(g.SourceFiles)
+	renamed := make(map[ID]ID, len(g.Jobs))
+
+	sorted := TopSort(g.Jobs)
+	for i := range sorted {
+		job := &sorted[i]
+		renameDeps(job, renamed)
+
+		id, err := jh.jobID(job)
+		if err != nil {
+			return err
+		}
+
+		pos := index[job.ID]
+		renamed[job.ID] = id
+		job.ID = id
+		g.Jobs[pos] = *job
+	}
+
+	return nil
+}
+
+// CheckIDs проверяет, что ID каждого джоба в графе совпадает с ID, который вычисляет JobID.
+func CheckIDs(g Graph) error {
+	if _, err := indexJobs(&g); err != nil {
+		return err
+	}
+
+	jh := newJobHasher(g.SourceFiles)
+	for i := range g.Jobs {
+		job := &g.Jobs[i]
+
+		id, err := jh.jobID(job)
+		if err != nil {
+			return err
+		}
+
+		if id != job.ID {
+			return fmt.Errorf("job %q has inconsistent id: expected %v, got %v", job.Name, id, job.ID)
+		}
+	}
+
+	return nil
+}
+
+// StrictID возвращает ID, под которым джоб id выполняется в строгом режиме.
+//
+// Результат джоба, выполненного без строгого режима, не проверялся на необъявленные входы,
+// поэтому строгие и обычные выполнения одного джоба хранятся в кешах под разными ключами.
+func StrictID(id ID) ID {
+	h := sha1.New()
+	writeString(h, "strict")
+	_, _ = h.Write(id[:])
+
+	var strict ID
+	copy(strict[:], h.Sum(nil))
+	return strict
+}
+
+// MakeStrict заменяет ID каждого джоба графа на StrictID и переписывает Deps и ссылки
+// на зависимости внутри Cmds.
+//
+// MakeStrict возвращает отображение исходных ID джобов в новые.
+func MakeStrict(g *Graph) (map[ID]ID, error) {
+	if _, err := indexJobs(g); err != nil {
+		return nil, err
+	}
+
+	renamed := make(map[ID]ID, len(g.Jobs))
+	for _, job := range g.Jobs {
+		renamed[job.ID] = StrictID(job.ID)
+	}
+
+	for i := range g.Jobs {
+		job := &g.Jobs[i]
+		renameDeps(job, renamed)
+		job.ID = renamed[job.ID]
+	}
+
+	return renamed, nil
+}
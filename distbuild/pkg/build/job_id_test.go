@@ -0,0 +1,127 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGraph() Graph {
+	return Graph{
+		SourceFiles: map[ID]string{
+			{'f', 'a'}: "a.go",
+			{'f', 'b'}: "b.go",
+		},
+		Jobs: []Job{
+			{
+				ID:   ID{'b'},
+				Name: "link",
+				Deps: []ID{{'a'}},
+				Cmds: []Cmd{
+					{Exec: []string{"ld", `{{index .Deps "6100000000000000000000000000000000000000"}}/a.o`}},
+				},
+			},
+			{
+				ID:     ID{'a'},
+				Name:   "compile",
+				Inputs: []string{"b.go", "a.go"},
+				Cmds: []Cmd{
+					{Exec: []string{"cc", "a.go", "b.go"}, Environ: []string{"GOOS=linux"}},
+				},
+			},
+		},
+	}
+}
+
+func TestAssignIDs(t *testing.T) {
+	g := newTestGraph()
+	require.NoError(t, AssignIDs(&g))
+
+	compile, link := g.Jobs[1], g.Jobs[0]
+	require.Equal(t, "compile", compile.Name)
+	require.Equal(t, "link", link.Name)
+
+	require.Equal(t, []ID{compile.ID}, link.Deps)
+	require.Equal(t, `{{index .Deps "`+compile.ID.String()+`"}}/a.o`, link.Cmds[0].Exec[1])
+
+	require.NoError(t, CheckIDs(g))
+
+	again := newTestGraph()
+	again.Jobs[0].ID, again.Jobs[1].ID = ID{'y'}, ID{'x'}
+	again.Jobs[0].Deps = []ID{{'x'}}
+	again.Jobs[0].Cmds[0].Exec[1] = `{{index .Deps "7800000000000000000000000000000000000000"}}/a.o`
+	require.NoError(t, AssignIDs(&again))
+	require.Equal(t, g, again)
+}
+
+func TestJobIDDependsOnContent(t *testing.T) {
+	g := newTestGraph()
+	job := g.Jobs[1]
+
+	id, err := JobID(&job, g.SourceFiles)
+	require.NoError(t, err)
+
+	job.Name = "renamed"
+	renamedID, err := JobID(&job, g.SourceFiles)
+	require.NoError(t, err)
+	require.Equal(t, id, renamedID)
+
+	job.Outputs = []string{"b.o"}
+	withOutputsID, err := JobID(&job, g.SourceFiles)
+	require.NoError(t, err)
+	require.NotEqual(t, id, withOutputsID)
+	job.Outputs = nil
+
+	changedFiles := map[ID]string{
+		{'f', 'a'}: "a.go",
+		{'f', 'c'}: "b.go",
+	}
+	changedID, err := JobID(&job, changedFiles)
+	require.NoError(t, err)
+	require.NotEqual(t, id, changedID)
+
+	job.Cmds = []Cmd{{Exec: []string{"cc", "a.go", "b.go"}, Environ: []string{"GOOS=darwin"}}}
+	changedID, err = JobID(&job, g.SourceFiles)
+	require.NoError(t, err)
+	require.NotEqual(t, id, changedID)
+
+	job.Inputs = []string{"c.go"}
+	_, err = JobID(&job, g.SourceFiles)
+	require.Error(t, err)
+}
+
+func TestCheckIDs(t *testing.T) {
+	g := newTestGraph()
+	require.Error(t, CheckIDs(g))
+
+	require.NoError(t, AssignIDs(&g))
+	require.NoError(t, CheckIDs(g))
+
+	g.Jobs[1].Cmds[0].Exec[0] = "gcc"
+	require.Error(t, CheckIDs(g))
+
+	g = newTestGraph()
+	g.Jobs[0].Deps = []ID{{'z'}}
+	require.Error(t, AssignIDs(&g))
+}
+
+func TestMakeStrict(t *testing.T) {
+	g := newTestGraph()
+	require.NoError(t, AssignIDs(&g))
+
+	strict := newTestGraph()
+	require.NoError(t, AssignIDs(&strict))
+
+	renamed, err := MakeStrict(&strict)
+	require.NoError(t, err)
+	require.NoError(t, strict.Validate())
+
+	compile, link := strict.Jobs[1], strict.Jobs[0]
+	require.Equal(t, StrictID(g.Jobs[1].ID), compile.ID)
+	require.Equal(t, StrictID(g.Jobs[0].ID), link.ID)
+	require.Equal(t, map[ID]ID{g.Jobs[0].ID: link.ID, g.Jobs[1].ID: compile.ID}, renamed)
+
+	require.NotEqual(t, g.Jobs[1].ID, compile.ID)
+	require.Equal(t, []ID{compile.ID}, link.Deps)
+	require.Equal(t, `{{index .Deps "`+compile.ID.String()+`"}}/a.o`, link.Cmds[0].Exec[1])
+}
@@ -0,0 +1,39 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var ErrUnsatisfied = errors.New("requirements are not satisfied")
+
+// Match проверяет, что воркер с метками labels и памятью memory подходит для джоба.
+//
+// Ошибка перечисляет все невыполненные требования. Nil Requirements подходят любому воркеру.
+func (r *Requirements) Match(labels map[string]string, memory int64) error {
+	if r == nil {
+		return nil
+	}
+
+	var missing []string
+	for name, value := range r.Labels {
+		actual, ok := labels[name]
+		switch {
+		case !ok && value == "":
+			missing = append(missing, fmt.Sprintf("label %s", name))
+		case !ok || value != "" && actual != value:
+			missing = append(missing, fmt.Sprintf("label %s=%s", name, value))
+		}
+	}
+	sort.Strings(missing)
+
+	if r.Memory > memory {
+		missing = append(missing, fmt.Sprintf("memory %d bytes", r.Memory))
+	}
+
+	if len(missing) != 0 {
+		return fmt.Errorf("%w: missing %v", ErrUnsatisfied, missing)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package build
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequirementsMatch(t *testing.T) {
+	labels := map[string]string{"os": "linux", "arch": "amd64", "gpu": "a100"}
+
+	var none *Requirements
+	require.NoError(t, none.Match(nil, 0))
+
+	r := &Requirements{Labels: map[string]string{"os": "linux", "gpu": ""}, Memory: 1 << 30}
+	require.NoError(t, r.Match(labels, 2<<30))
+
+	err := r.Match(labels, 1<<20)
+	require.True(t, errors.Is(err, ErrUnsatisfied))
+	require.Contains(t, err.Error(), "memory")
+
+	err = r.Match(map[string]string{"os": "darwin"}, 2<<30)
+	require.True(t, errors.Is(err, ErrUnsatisfied))
+	require.Contains(t, err.Error(), "[label gpu label os=linux]")
+}
+
+func TestJobIDDependsOnRequirements(t *testing.T) {
+	g := newTestGraph()
+	job := g.Jobs[1]
+
+	id, err := JobID(&job, g.SourceFiles)
+	require.NoError(t, err)
+
+	job.Requirements = &Requirements{Labels: map[string]string{"os": "linux"}}
+	linuxID, err := JobID(&job, g.SourceFiles)
+	require.NoError(t, err)
+	require.NotEqual(t, id, linuxID)
+
+	job.Requirements = &Requirements{Labels: map[string]string{"os": "darwin"}}
+	darwinID, err := JobID(&job, g.SourceFiles)
+	require.NoError(t, err)
+	require.NotEqual(t, linuxID, darwinID)
+}
@@ -0,0 +1,34 @@
+package build
+
+// Resources описывает ресурсы воркера, которые занимает джоб.
+type Resources struct {
+	// CPU задаёт число слотов процессора.
+	CPU int `json:",omitempty"`
+
+	// Memory задаёт объём памяти в байтах.
+	Memory int64 `json:",omitempty"`
+}
+
+// DefaultResources занимает джоб, у которого не заполнено поле Resources.
+var DefaultResources = Resources{CPU: 1}
+
+// Cost возвращает ресурсы, которые занимает джоб.
+func (job *Job) Cost() Resources {
+	if job.Resources == nil {
+		return DefaultResources
+	}
+	return *job.Resources
+}
+
+// Fits проверяет, что r помещается в свободные ресурсы free.
+func (r Resources) Fits(free Resources) bool {
+	return r.CPU <= free.CPU && r.Memory <= free.Memory
+}
+
+func (r Resources) Add(other Resources) Resources {
+	return Resources{CPU: r.CPU + other.CPU, Memory: r.Memory + other.Memory}
+}
+
+func (r Resources) Sub(other Resources) Resources {
+	return Resources{CPU: r.CPU - other.CPU, Memory: r.Memory - other.Memory}
+}
@@ -0,0 +1,21 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResources(t *testing.T) {
+	require.Equal(t, DefaultResources, (&Job{}).Cost())
+
+	link := &Job{Resources: &Resources{CPU: 4, Memory: 2 << 30}}
+	cat := &Job{Resources: &Resources{}}
+
+	free := Resources{CPU: 8, Memory: 3 << 30}
+	require.True(t, link.Cost().Fits(free))
+	require.False(t, link.Cost().Fits(free.Sub(link.Cost())), "second linker doesn't fit into memory")
+	require.True(t, cat.Cost().Fits(Resources{}))
+
+	require.Equal(t, free, free.Sub(link.Cost()).Add(link.Cost()))
+}
@@ -0,0 +1,148 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Ошибки, которые возвращает Validate.
+var (
+	ErrDuplicateJob     = errors.New("duplicate job id")
+	ErrMissingDep       = errors.New("missing dependency")
+	ErrMissingInput     = errors.New("input is missing from source files")
+	ErrInvalidCmd       = errors.New("invalid cmd")
+	ErrInvalidOutput    = errors.New("invalid output")
+	ErrInvalidResources = errors.New("invalid resources")
+	ErrCycle            = errors.New("dependency cycle")
+)
+
+func jobName(job *Job) string {
+	return fmt.Sprintf("%q (%v)", job.Name, job.ID)
+}
+
+// Validate проверяет, что граф корректен.
+//
+// Validate находит повторяющиеся ID джобов, зависимости от несуществующих джобов, входы, которых нет
+// в SourceFiles, команды, заданные одновременно как exec и cat, выходы, которые не являются локальными
+// путями или объявлены дважды, отрицательные ресурсы и циклы зависимостей. Все найденные ошибки
+// объединяются в одну, конкретный вид ошибки проверяется через errors.Is.
+func (g *Graph) Validate() error {
+	var errs []error
+
+	sourceFiles := make(map[string]struct{}, len(g.SourceFiles))
+	for _, path := range g.SourceFiles {
+		sourceFiles[path] = struct{}{}
+	}
+
+	index := make(map[ID]int, len(g.Jobs))
+	for i := range g.Jobs {
+		job := &g.Jobs[i]
+
+		if j, ok := index[job.ID]; ok {
+			errs = append(errs, fmt.Errorf("%w: jobs %s and %s", ErrDuplicateJob, jobName(&g.Jobs[j]), jobName(job)))
+			continue
+		}
+		index[job.ID] = i
+	}
+
+	for i := range g.Jobs {
+		job := &g.Jobs[i]
+
+		for _, dep := range job.Deps {
+			if _, ok := index[dep]; !ok {
+				errs = append(errs, fmt.Errorf("%w: job %s depends on %v", ErrMissingDep, jobName(job), dep))
+			}
+		}
+
+		for _, input := range job.Inputs {
+			if _, ok := sourceFiles[input]; !ok {
+				errs = append(errs, fmt.Errorf("%w: job %s requires %q", ErrMissingInput, jobName(job), input))
+			}
+		}
+
+		for j, cmd := range job.Cmds {
+			if len(cmd.Exec) != 0 && (cmd.CatTemplate != "" || cmd.CatOutput != "") {
+				errs = append(errs, fmt.Errorf("%w: job %s cmd #%d sets both exec and cat fields", ErrInvalidCmd, jobName(job), j))
+			}
+		}
+
+		if r := job.Resources; r != nil && (r.CPU < 0 || r.Memory < 0) {
+			errs = append(errs, fmt.Errorf("%w: job %s requests %d cpu and %d bytes of memory", ErrInvalidResources, jobName(job), r.CPU, r.Memory))
+		}
+
+		outputs := make(map[string]struct{}, len(job.Outputs))
+		for _, output := range job.Outputs {
+			clean := path.Clean(output)
+			if !filepath.IsLocal(filepath.FromSlash(output)) || clean == "." {
+				errs = append(errs, fmt.Errorf("%w: job %s declares output %q outside of output dir", ErrInvalidOutput, jobName(job), output))
+				continue
+			}
+
+			if _, ok := outputs[clean]; ok {
+				errs = append(errs, fmt.Errorf("%w: job %s declares output %q twice", ErrInvalidOutput, jobName(job), output))
+			}
+			outputs[clean] = struct{}{}
+		}
+	}
+
+	errs = append(errs, findCycles(g.Jobs, index)...)
+	return errors.Join(errs...)
+}
+
+func findCycles(jobs []Job, index map[ID]int) []error {
+	const (
+		white = iota
+		grey
+		black
+	)
+
+	var errs []error
+	color := make([]int, len(jobs))
+
+	var stack []int
+	var visit func(jobIndex int)
+	visit = func(jobIndex int) {
+		color[jobIndex] = grey
+		stack = append(stack, jobIndex)
+
+		for _, dep := range jobs[jobIndex].Deps {
+			depIndex, ok := index[dep]
+			if !ok {
+				continue
+			}
+
+			switch color[depIndex] {
+			case white:
+				visit(depIndex)
+
+			case grey:
+				var path []string
+				for k := len(stack) - 1; k >= 0; k-- {
+					if stack[k] == depIndex {
+						for _, l := range stack[k:] {
+							path = append(path, jobName(&jobs[l]))
+						}
+						break
+					}
+				}
+				path = append(path, jobName(&jobs[depIndex]))
+
+				errs = append(errs, fmt.Errorf("%w: %s", ErrCycle, strings.Join(path, " -> ")))
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		color[jobIndex] = black
+	}
+
+	for i := range jobs {
+		if color[i] == white {
+			visit(i)
+		}
+	}
+
+	return errs
+}
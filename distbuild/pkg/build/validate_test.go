@@ -0,0 +1,95 @@
+package build
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	g := newTestGraph()
+	require.NoError(t, g.Validate())
+
+	for _, testCase := range []struct {
+		name   string
+		modify func(g *Graph)
+		err    error
+	}{
+		{
+			name:   "DuplicateJob",
+			modify: func(g *Graph) { g.Jobs = append(g.Jobs, Job{ID: ID{'a'}}) },
+			err:    ErrDuplicateJob,
+		},
+		{
+			name:   "MissingDep",
+			modify: func(g *Graph) { g.Jobs[0].Deps = append(g.Jobs[0].Deps, ID{'z'}) },
+			err:    ErrMissingDep,
+		},
+		{
+			name:   "MissingInput",
+			modify: func(g *Graph) { g.Jobs[1].Inputs = append(g.Jobs[1].Inputs, "c.go") },
+			err:    ErrMissingInput,
+		},
+		{
+			name:   "InvalidCmd",
+			modify: func(g *Graph) { g.Jobs[0].Cmds[0].CatOutput = "{{.OutputDir}}/out" },
+			err:    ErrInvalidCmd,
+		},
+		{
+			name:   "OutputOutsideDir",
+			modify: func(g *Graph) { g.Jobs[0].Outputs = []string{"../a.out"} },
+			err:    ErrInvalidOutput,
+		},
+		{
+			name:   "DuplicateOutput",
+			modify: func(g *Graph) { g.Jobs[0].Outputs = []string{"bin/a.out", "bin//a.out"} },
+			err:    ErrInvalidOutput,
+		},
+		{
+			name:   "NegativeCPU",
+			modify: func(g *Graph) { g.Jobs[0].Resources = &Resources{CPU: -1} },
+			err:    ErrInvalidResources,
+		},
+		{
+			name:   "NegativeMemory",
+			modify: func(g *Graph) { g.Jobs[0].Resources = &Resources{CPU: 1, Memory: -1} },
+			err:    ErrInvalidResources,
+		},
+		{
+			name:   "SelfCycle",
+			modify: func(g *Graph) { g.Jobs[1].Deps = []ID{{'a'}} },
+			err:    ErrCycle,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			g := newTestGraph()
+			testCase.modify(&g)
+
+			err := g.Validate()
+			require.Truef(t, errors.Is(err, testCase.err), "%v", err)
+		})
+	}
+}
+
+func TestValidateCyclePath(t *testing.T) {
+	g := Graph{
+		Jobs: []Job{
+			{ID: ID{'a'}, Name: "a", Deps: []ID{{'b'}}},
+			{ID: ID{'b'}, Name: "b", Deps: []ID{{'c'}}},
+			{ID: ID{'c'}, Name: "c", Deps: []ID{{'a'}}},
+			{ID: ID{'d'}, Name: "d", Deps: []ID{{'a'}}},
+		},
+	}
+
+	err := g.Validate()
+	require.Truef(t, errors.Is(err, ErrCycle), "%v", err)
+	require.Equal(t,
+		`dependency cycle: "a" (6100000000000000000000000000000000000000) -> `+
+			`"b" (6200000000000000000000000000000000000000) -> `+
+			`"c" (6300000000000000000000000000000000000000) -> `+
+			`"a" (6100000000000000000000000000000000000000)`,
+		err.Error())
+
+	require.Error(t, AssignIDs(&g))
+}
@@ -4,6 +4,7 @@ package client
 
 import (
 	"context"
+	"net/http"
 
 	"go.uber.org/zap"
 
@@ -21,6 +22,16 @@ func NewClient(
 	panic("implement me")
 }
 
+// NewClientWithHTTPClient создаёт клиента, который делает все запросы к координатору через client.
+func NewClientWithHTTPClient(
+	l *zap.Logger,
+	apiEndpoint string,
+	sourceDir string,
+	client *http.Client,
+) *Client {
+	panic("implement me")
+}
+
 type BuildListener interface {
 	OnJobStdout(jobID build.ID, stdout []byte) error
 	OnJobStderr(jobID build.ID, stderr []byte) error
@@ -29,6 +40,20 @@ type BuildListener interface {
 	OnJobFailed(jobID build.ID, code int, error string) error
 }
 
+// BuildStartedListener может дополнительно реализовать BuildListener, чтобы узнать ID билда.
+// По этому ID к билду можно подключиться заново вызовом Attach.
+type BuildStartedListener interface {
+	OnBuildStarted(buildID build.ID) error
+}
+
 func (c *Client) Build(ctx context.Context, graph build.Graph, lsn BuildListener) error {
 	panic("implement me")
 }
+
+// Attach подключается к уже идущему билду buildID. Attach передаёт в lsn результаты всех завершённых
+// джобов билда, затем следит за прогрессом так же, как Build, и возвращается после завершения билда.
+//
+// Отмена ctx отключает клиента от билда, но не отменяет сам билд.
+func (c *Client) Attach(ctx context.Context, buildID build.ID, lsn BuildListener) error {
+	panic("implement me")
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// jobOutput remembers how much of each job output was already passed to BuildListener.
+//
+// Chunks are forwarded only in order. Duplicated and out of order chunks are dropped,
+// the missing part is delivered from the final JobResult.
+type jobOutput struct {
+	delivered map[build.ID]map[api.OutputStream]int64
+}
+
+func newJobOutput() *jobOutput {
+	return &jobOutput{delivered: map[build.ID]map[api.OutputStream]int64{}}
+}
+
+func (o *jobOutput) deliver(lsn BuildListener, id build.ID, stream api.OutputStream, offset int64, data []byte) error {
+	streams, ok := o.delivered[id]
+	if !ok {
+		streams = map[api.OutputStream]int64{}
+		o.delivered[id] = streams
+	}
+
+	delivered := streams[stream]
+	if offset > delivered || offset+int64(len(data)) <= delivered {
+		return nil
+	}
+
+	data = data[delivered-offset:]
+	streams[stream] += int64(len(data))
+
+	switch stream {
+	case api.Stdout:
+		return lsn.OnJobStdout(id, data)
+	case api.Stderr:
+		return lsn.OnJobStderr(id, data)
+	default:
+		return nil
+	}
+}
+
+func (o *jobOutput) onOutput(lsn BuildListener, chunk *api.JobOutput) error {
+	return o.deliver(lsn, chunk.ID, chunk.Stream, chunk.Offset, chunk.Data)
+}
+
+// onFinished delivers the rest of job output. It must be called before OnJobFinished or OnJobFailed.
+func (o *jobOutput) onFinished(lsn BuildListener, result *api.JobResult) error {
+	if len(result.Stdout) != 0 {
+		if err := o.deliver(lsn, result.ID, api.Stdout, 0, result.Stdout); err != nil {
+			return err
+		}
+	}
+
+	if len(result.Stderr) != 0 {
+		if err := o.deliver(lsn, result.ID, api.Stderr, 0, result.Stderr); err != nil {
+			return err
+		}
+	}
+
+	delete(o.delivered, result.ID)
+	return nil
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+type outputRecorder struct {
+	stdout, stderr []string
+}
+
+func (r *outputRecorder) OnJobStdout(jobID build.ID, stdout []byte) error {
+	r.stdout = append(r.stdout, string(stdout))
+	return nil
+}
+
+func (r *outputRecorder) OnJobStderr(jobID build.ID, stderr []byte) error {
+	r.stderr = append(r.stderr, string(stderr))
+	return nil
+}
+
+func (r *outputRecorder) OnJobFinished(jobID build.ID) error { return nil }
+
+func (r *outputRecorder) OnJobFailed(jobID build.ID, code int, error string) error { return nil }
+
+func TestJobOutput(t *testing.T) {
+	id := build.ID{'a'}
+	r := &outputRecorder{}
+	o := newJobOutput()
+
+	for _, chunk := range []api.JobOutput{
+		{ID: id, Stream: api.Stdout, Offset: 0, Data: []byte("hello ")},
+		{ID: id, Stream: api.Stderr, Offset: 0, Data: []byte("warning")},
+		{ID: id, Stream: api.Stdout, Offset: 0, Data: []byte("hello ")},
+		{ID: id, Stream: api.Stdout, Offset: 3, Data: []byte("lo wor")},
+		{ID: id, Stream: api.Stdout, Offset: 20, Data: []byte("lost")},
+	} {
+		require.NoError(t, o.onOutput(r, &chunk))
+	}
+
+	require.Equal(t, []string{"hello ", "wor"}, r.stdout)
+	require.Equal(t, []string{"warning"}, r.stderr)
+
+	require.NoError(t, o.onFinished(r, &api.JobResult{
+		ID:     id,
+		Stdout: []byte("hello world\n"),
+		Stderr: []byte("warning"),
+	}))
+
+	require.Equal(t, []string{"hello ", "wor", "ld\n"}, r.stdout)
+	require.Equal(t, []string{"warning"}, r.stderr)
+}
+
+func TestJobOutputWithoutChunks(t *testing.T) {
+	id := build.ID{'a'}
+	r := &outputRecorder{}
+
+	require.NoError(t, newJobOutput().onFinished(r, &api.JobResult{ID: id, Stdout: []byte("OK\n")}))
+	require.Equal(t, []string{"OK\n"}, r.stdout)
+	require.Empty(t, r.stderr)
+}
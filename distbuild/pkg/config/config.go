@@ -0,0 +1,166 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+)
+
+// Coordinator задаёт настройки процесса координатора.
+type Coordinator struct {
+	// Listen задаёт адрес, на котором координатор принимает запросы клиентов и воркеров.
+	Listen string `yaml:"listen"`
+
+	// CacheDir задаёт директорию кеша файлов с исходным кодом.
+	CacheDir string `yaml:"cache_dir"`
+
+	// JournalDir задаёт директорию журнала. Если директория не задана, журнал не ведётся.
+	JournalDir string `yaml:"journal_dir"`
+
+	// HeartbeatTimeout задаёт, через сколько времени без heartbeat-ов воркер считается потерянным.
+	HeartbeatTimeout time.Duration `yaml:"heartbeat_timeout"`
+
+	Auth auth.Files `yaml:",inline"`
+}
+
+func DefaultCoordinator() *Coordinator {
+	return &Coordinator{
+		Listen:           ":8080",
+		CacheDir:         "coordinator/filecache",
+		HeartbeatTimeout: scheduler.DefaultHeartbeatTimeout,
+	}
+}
+
+func (c *Coordinator) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Listen, "listen", c.Listen, "address to listen on")
+	fs.StringVar(&c.CacheDir, "cache-dir", c.CacheDir, "directory of the source file cache")
+	fs.StringVar(&c.JournalDir, "journal-dir", c.JournalDir, "directory of the write-ahead journal, disabled if empty")
+	fs.DurationVar(&c.HeartbeatTimeout, "heartbeat-timeout", c.HeartbeatTimeout, "time without heartbeats after which a worker is lost")
+	c.Auth.RegisterFlags(fs)
+}
+
+// Worker задаёт настройки процесса воркера.
+type Worker struct {
+	// Listen задаёт адрес, на котором воркер раздаёт артефакты.
+	Listen string `yaml:"listen"`
+
+	// Endpoint задаёт адрес, по которому воркер доступен координатору и другим воркерам.
+	// Endpoint используется как api.WorkerID.
+	Endpoint string `yaml:"endpoint"`
+
+	// Coordinator задаёт адрес координатора.
+	Coordinator string `yaml:"coordinator"`
+
+	// CacheDir задаёт корневую директорию кеша файлов и кеша артефактов.
+	CacheDir string `yaml:"cache_dir"`
+
+	// MaxSize задаёт суммарный размер артефактов в кеше воркера в байтах. Ноль означает отсутствие ограничения.
+	MaxSize int64 `yaml:"max_size"`
+
+	// MaxEntries задаёт максимальное число артефактов в кеше воркера. Ноль означает отсутствие ограничения.
+	MaxEntries int `yaml:"max_entries"`
+
+	// VerifyOnGet включает проверку содержимого артефакта по манифесту при каждом чтении из кеша.
+	VerifyOnGet bool `yaml:"verify_on_get"`
+
+	Auth auth.Files `yaml:",inline"`
+}
+
+// ArtifactCache возвращает настройки кеша артефактов воркера.
+func (c *Worker) ArtifactCache() artifact.Config {
+	return artifact.Config{
+		MaxSize:     c.MaxSize,
+		MaxEntries:  c.MaxEntries,
+		VerifyOnGet: c.VerifyOnGet,
+	}
+}
+
+func DefaultWorker() *Worker {
+	return &Worker{
+		Listen:      ":8081",
+		Endpoint:    "http://localhost:8081",
+		Coordinator: "http://localhost:8080",
+		CacheDir:    "worker",
+	}
+}
+
+func (c *Worker) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Listen, "listen", c.Listen, "address to listen on")
+	fs.StringVar(&c.Endpoint, "endpoint", c.Endpoint, "address of this worker, as seen by the coordinator and other workers")
+	fs.StringVar(&c.Coordinator, "coordinator", c.Coordinator, "coordinator endpoint")
+	fs.StringVar(&c.CacheDir, "cache-dir", c.CacheDir, "root directory of the file and artifact caches")
+	fs.Int64Var(&c.MaxSize, "max-size", c.MaxSize, "total size of artifacts in the cache in bytes, unlimited if zero")
+	fs.IntVar(&c.MaxEntries, "max-entries", c.MaxEntries, "number of artifacts in the cache, unlimited if zero")
+	fs.BoolVar(&c.VerifyOnGet, "verify-on-get", c.VerifyOnGet, "verify artifact contents against the manifest on every read")
+	c.Auth.RegisterFlags(fs)
+}
+
+// Client задаёт настройки клиента.
+type Client struct {
+	// Coordinator задаёт адрес координатора.
+	Coordinator string `yaml:"coordinator"`
+
+	// SourceDir задаёт директорию с исходным кодом.
+	SourceDir string `yaml:"source_dir"`
+
+	Auth auth.Files `yaml:",inline"`
+}
+
+func DefaultClient() *Client {
+	return &Client{
+		Coordinator: "http://localhost:8080",
+		SourceDir:   ".",
+	}
+}
+
+func (c *Client) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Coordinator, "coordinator", c.Coordinator, "coordinator endpoint")
+	fs.StringVar(&c.SourceDir, "source-dir", c.SourceDir, "directory with source files")
+	c.Auth.RegisterFlags(fs)
+}
+
+// Load читает YAML файл path в cfg. Поля, которых нет в файле, сохраняют прежние значения,
+// а неизвестные поля приводят к ошибке.
+func Load(path string, cfg any) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+		return fmt.Errorf("error reading config %s: %w", path, err)
+	}
+	return nil
+}
+
+// Parse разбирает флаги командной строки args в cfg.
+//
+// Если передан флаг -config, настройки сначала читаются из YAML файла, а флаги, явно заданные
+// в командной строке, имеют приоритет над файлом.
+func Parse(fs *flag.FlagSet, args []string, cfg interface{ RegisterFlags(*flag.FlagSet) }) error {
+	var path string
+	fs.StringVar(&path, "config", "", "path to YAML config")
+	cfg.RegisterFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if path == "" {
+		return nil
+	}
+
+	if err := Load(path, cfg); err != nil {
+		return err
+	}
+
+	// Parse again, so that explicit flags override values from the file.
+	return fs.Parse(args)
+}
@@ -0,0 +1,83 @@
+package config_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+	"gitlab.com/slon/shad-go/distbuild/pkg/config"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0666))
+	return path
+}
+
+func TestParse_Defaults(t *testing.T) {
+	cfg := config.DefaultWorker()
+	require.NoError(t, config.Parse(flag.NewFlagSet("worker", flag.ContinueOnError), nil, cfg))
+	require.Equal(t, config.DefaultWorker(), cfg)
+}
+
+func TestParse_File(t *testing.T) {
+	path := writeConfig(t, `
+listen: ":9000"
+journal_dir: /var/lib/distbuild/journal
+heartbeat_timeout: 5s
+cert_file: /etc/distbuild/cert.pem
+`)
+
+	cfg := config.DefaultCoordinator()
+	require.NoError(t, config.Parse(flag.NewFlagSet("coordinator", flag.ContinueOnError), []string{"-config", path}, cfg))
+
+	require.Equal(t, &config.Coordinator{
+		Listen:           ":9000",
+		CacheDir:         config.DefaultCoordinator().CacheDir,
+		JournalDir:       "/var/lib/distbuild/journal",
+		HeartbeatTimeout: 5 * time.Second,
+		Auth:             auth.Files{CertFile: "/etc/distbuild/cert.pem"},
+	}, cfg)
+}
+
+func TestParse_FlagsOverrideFile(t *testing.T) {
+	path := writeConfig(t, `
+coordinator: http://coordinator:8080
+source_dir: /src
+`)
+
+	args := []string{"-source-dir", "/other", "-config", path, "graph.json"}
+	fs := flag.NewFlagSet("distbuild", flag.ContinueOnError)
+
+	cfg := config.DefaultClient()
+	require.NoError(t, config.Parse(fs, args, cfg))
+
+	require.Equal(t, &config.Client{Coordinator: "http://coordinator:8080", SourceDir: "/other"}, cfg)
+	require.Equal(t, []string{"graph.json"}, fs.Args())
+}
+
+func TestParse_WorkerCache(t *testing.T) {
+	path := writeConfig(t, `
+max_size: 1073741824
+verify_on_get: true
+`)
+
+	cfg := config.DefaultWorker()
+	require.NoError(t, config.Parse(flag.NewFlagSet("worker", flag.ContinueOnError), []string{"-max-entries", "100", "-config", path}, cfg))
+
+	require.Equal(t, artifact.Config{MaxSize: 1 << 30, MaxEntries: 100, VerifyOnGet: true}, cfg.ArtifactCache())
+}
+
+func TestParse_UnknownField(t *testing.T) {
+	path := writeConfig(t, "cache_dri: /tmp\n")
+
+	err := config.Parse(flag.NewFlagSet("worker", flag.ContinueOnError), []string{"-config", path}, config.DefaultWorker())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cache_dri")
+}
@@ -0,0 +1,19 @@
+package dist
+
+import (
+	"gitlab.com/slon/shad-go/distbuild/pkg/journal"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+)
+
+// Config задаёт параметры координатора для NewCoordinatorWithConfig.
+type Config struct {
+	// Scheduler задаёт таймауты шедулера. Нулевое значение заменяется таймаутами по умолчанию.
+	Scheduler scheduler.Config
+
+	// Health задаёт, когда воркер считается потерянным и когда он уходит в карантин.
+	Health scheduler.HealthConfig
+
+	// Journal и State включают восстановление из журнала, см. NewCoordinatorWithJournal.
+	Journal *journal.Journal
+	State   *journal.State
+}
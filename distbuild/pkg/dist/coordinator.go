@@ -8,8 +8,12 @@ import (
 
 	"go.uber.org/zap"
 
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
 	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+	"gitlab.com/slon/shad-go/distbuild/pkg/journal"
 	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+	"gitlab.com/slon/shad-go/distbuild/pkg/trace"
 )
 
 type Coordinator struct {
@@ -27,6 +31,44 @@ func NewCoordinator(
 	panic("implement me")
 }
 
+// NewCoordinatorWithJournal создаёт координатора, который восстанавливает состояние из журнала
+// и записывает в журнал все изменения, см. пакет journal.
+func NewCoordinatorWithJournal(
+	log *zap.Logger,
+	fileCache *filecache.Cache,
+	j *journal.Journal,
+	state *journal.State,
+) *Coordinator {
+	panic("implement me")
+}
+
+// NewCoordinatorWithConfig создаёт координатора с параметрами config.
+//
+// NewCoordinator и NewCoordinatorWithJournal работают так же, как NewCoordinatorWithConfig
+// с нулевыми Config.Scheduler и Config.Health.
+func NewCoordinatorWithConfig(
+	log *zap.Logger,
+	fileCache *filecache.Cache,
+	config Config,
+) *Coordinator {
+	panic("implement me")
+}
+
 func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	panic("implement me")
 }
+
+// Close останавливает координатора и убирает его очередь из метрики distbuild_coordinator_queue_depth.
+func (c *Coordinator) Close() {
+	panic("implement me")
+}
+
+// Status возвращает состояние кластера для страницы статуса, см. NewStatusHandler.
+func (c *Coordinator) Status() *api.ClusterStatus {
+	panic("implement me")
+}
+
+// Trace возвращает трейс билда или nil, если билд неизвестен. См. NewTraceHandler.
+func (c *Coordinator) Trace(buildID build.ID) *trace.Trace {
+	panic("implement me")
+}
@@ -0,0 +1,147 @@
+package dist
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// DefaultHistoryTTL задаёт, сколько координатор хранит историю завершённого билда.
+const DefaultHistoryTTL = 10 * time.Minute
+
+// BuildHistory хранит все сообщения о прогрессе одного билда.
+//
+// Координатор добавляет в историю каждое сообщение, которое посылает клиенту билда, а клиенты,
+// подключившиеся через AttachBuild, читают историю вызовом Follow.
+type BuildHistory struct {
+	mu      sync.Mutex
+	updates []*api.StatusUpdate
+	done    bool
+	changed chan struct{}
+
+	finishedAt time.Time
+}
+
+// NewBuildHistory создаёт историю, начинающуюся с updates. Используется при восстановлении билда из журнала.
+func NewBuildHistory(updates []api.StatusUpdate) *BuildHistory {
+	h := &BuildHistory{changed: make(chan struct{})}
+	for i := range updates {
+		h.Append(&updates[i])
+	}
+	return h
+}
+
+// Append добавляет сообщение в историю. После BuildFinished или BuildFailed история считается завершённой.
+func (h *BuildHistory) Append(update *api.StatusUpdate) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.done {
+		return
+	}
+
+	h.updates = append(h.updates, update)
+	h.done = update.BuildFinished != nil || update.BuildFailed != nil
+	if h.done {
+		h.finishedAt = time.Now()
+	}
+
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// Follow пишет в w все сообщения истории, а затем новые сообщения по мере их появления.
+//
+// Follow возвращается после того, как записал последнее сообщение билда, либо при отмене ctx.
+func (h *BuildHistory) Follow(ctx context.Context, w api.StatusWriter) error {
+	next := 0
+	for {
+		h.mu.Lock()
+		pending := h.updates[next:]
+		done := h.done
+		changed := h.changed
+		h.mu.Unlock()
+
+		for _, update := range pending {
+			if err := w.Updated(update); err != nil {
+				return err
+			}
+		}
+		next += len(pending)
+
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// HistoryStore хранит истории билдов по ID.
+//
+// История завершённого билда удаляется через TTL после последнего сообщения, чтобы память
+// координатора не росла бесконечно. После этого AttachBuild к такому билду возвращает ошибку.
+type HistoryStore struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	histories map[build.ID]*BuildHistory
+}
+
+// NewHistoryStore создаёт хранилище историй. Неположительный ttl заменяется на DefaultHistoryTTL.
+func NewHistoryStore(ttl time.Duration) *HistoryStore {
+	if ttl <= 0 {
+		ttl = DefaultHistoryTTL
+	}
+
+	return &HistoryStore{
+		ttl:       ttl,
+		histories: map[build.ID]*BuildHistory{},
+	}
+}
+
+// Add сохраняет историю билда.
+func (s *HistoryStore) Add(id build.ID, h *BuildHistory) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.histories[id] = h
+}
+
+// Get возвращает историю билда для AttachBuild.
+func (s *HistoryStore) Get(id build.ID) (*BuildHistory, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.histories[id]
+	return h, ok
+}
+
+// Expire удаляет истории билдов, завершившихся раньше, чем now - ttl, и возвращает их ID.
+//
+// Координатор должен периодически вызывать Expire, например, раз в минуту.
+// Клиенты, которые уже читают удалённую историю через Follow, дочитывают её до конца.
+func (s *HistoryStore) Expire(now time.Time) []build.ID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []build.ID
+	for id, h := range s.histories {
+		h.mu.Lock()
+		old := h.done && now.Sub(h.finishedAt) > s.ttl
+		h.mu.Unlock()
+
+		if old {
+			delete(s.histories, id)
+			expired = append(expired, id)
+		}
+	}
+	return expired
+}
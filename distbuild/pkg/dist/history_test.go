@@ -0,0 +1,101 @@
+package dist_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/dist"
+)
+
+type collector struct {
+	updates chan *api.StatusUpdate
+}
+
+func newCollector() *collector {
+	return &collector{updates: make(chan *api.StatusUpdate, 16)}
+}
+
+func (c *collector) Started(rsp *api.BuildStarted) error {
+	panic("unexpected call")
+}
+
+func (c *collector) Updated(update *api.StatusUpdate) error {
+	c.updates <- update
+	return nil
+}
+
+func finished(id build.ID) *api.StatusUpdate {
+	return &api.StatusUpdate{JobFinished: &api.JobResult{ID: id}}
+}
+
+func TestBuildHistory_Replay(t *testing.T) {
+	h := dist.NewBuildHistory([]api.StatusUpdate{
+		*finished(build.ID{'a'}),
+		{BuildFinished: &api.BuildFinished{}},
+	})
+
+	c := newCollector()
+	require.NoError(t, h.Follow(context.Background(), c))
+
+	require.Len(t, c.updates, 2)
+	require.Equal(t, finished(build.ID{'a'}), <-c.updates)
+	require.NotNil(t, (<-c.updates).BuildFinished)
+}
+
+func TestBuildHistory_Follow(t *testing.T) {
+	h := dist.NewBuildHistory(nil)
+	h.Append(finished(build.ID{'a'}))
+
+	c := newCollector()
+	errCh := make(chan error, 1)
+	go func() { errCh <- h.Follow(context.Background(), c) }()
+
+	require.Equal(t, finished(build.ID{'a'}), <-c.updates)
+
+	h.Append(finished(build.ID{'b'}))
+	require.Equal(t, finished(build.ID{'b'}), <-c.updates)
+
+	h.Append(&api.StatusUpdate{BuildFailed: &api.BuildFailed{Error: "foo"}})
+	require.Equal(t, "foo", (<-c.updates).BuildFailed.Error)
+
+	require.NoError(t, <-errCh)
+
+	// Updates after the end of the build are ignored.
+	h.Append(finished(build.ID{'c'}))
+
+	replay := newCollector()
+	require.NoError(t, h.Follow(context.Background(), replay))
+	require.Len(t, replay.updates, 3)
+}
+
+func TestBuildHistory_Cancel(t *testing.T) {
+	h := dist.NewBuildHistory(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, h.Follow(ctx, newCollector()), context.DeadlineExceeded)
+}
+
+func TestHistoryStore_Expire(t *testing.T) {
+	s := dist.NewHistoryStore(time.Minute)
+
+	running := dist.NewBuildHistory(nil)
+	s.Add(build.ID{'r'}, running)
+	s.Add(build.ID{'f'}, dist.NewBuildHistory([]api.StatusUpdate{{BuildFinished: &api.BuildFinished{}}}))
+
+	require.Empty(t, s.Expire(time.Now()))
+
+	require.Equal(t, []build.ID{{'f'}}, s.Expire(time.Now().Add(2*time.Minute)))
+	_, ok := s.Get(build.ID{'f'})
+	require.False(t, ok)
+
+	h, ok := s.Get(build.ID{'r'})
+	require.True(t, ok)
+	require.Equal(t, running, h)
+}
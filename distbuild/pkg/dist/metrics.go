@@ -0,0 +1,18 @@
+package dist
+
+import "gitlab.com/slon/shad-go/distbuild/pkg/metrics"
+
+var (
+	buildsStarted = metrics.Default.Counter("distbuild_coordinator_builds_started_total",
+		"Builds started by clients.")
+	buildsRunning = metrics.Default.Gauge("distbuild_coordinator_builds_running",
+		"Builds that are not finished yet.")
+)
+
+// registerQueueDepth exports the number of jobs waiting for a worker.
+// Queues of all coordinators in the process are summed, unregister removes this one.
+func registerQueueDepth(depth func() int) (unregister func()) {
+	return metrics.Default.GaugeFunc("distbuild_coordinator_queue_depth", "Jobs waiting for a worker.", func() float64 {
+		return float64(depth())
+	})
+}
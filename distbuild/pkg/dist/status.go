@@ -0,0 +1,87 @@
+package dist
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/trace"
+)
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head><title>distbuild</title></head>
+<body>
+<h1>Workers</h1>
+<table border="1">
+<tr><th>ID</th><th>Labels</th><th>Free slots</th><th>Running jobs</th><th>Last heartbeat</th><th>State</th></tr>
+{{- range .Workers}}
+<tr>
+<td>{{.ID}}</td>
+<td>{{range $k, $v := .Labels}}{{$k}}={{$v}} {{end}}</td>
+<td>{{.FreeSlots}}</td>
+<td>{{len .RunningJobs}}</td>
+<td>{{.LastHeartbeat.Format "2006-01-02 15:04:05"}}</td>
+<td>{{if .Lost}}lost{{else if .Quarantined}}quarantined{{else}}ok{{end}}</td>
+</tr>
+{{- end}}
+</table>
+<h1>Builds</h1>
+<p>{{.QueueLength}} jobs in queue</p>
+<table border="1">
+<tr><th>ID</th><th>Priority</th><th>Started</th><th>Progress</th></tr>
+{{- range .Builds}}
+<tr>
+<td>{{.ID}}</td>
+<td>{{.Priority}}</td>
+<td>{{.StartedAt.Format "2006-01-02 15:04:05"}}</td>
+<td>{{.FinishedJobs}}/{{.TotalJobs}}</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// NewStatusHandler возвращает хендлер страницы статуса кластера.
+//
+// По умолчанию хендлер отдаёт HTML страницу. Если запрос содержит параметр format=json
+// или заголовок Accept: application/json, хендлер отдаёт api.ClusterStatus в формате json.
+func NewStatusHandler(status func() *api.ClusterStatus) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := status()
+
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(s)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = statusTemplate.Execute(w, s)
+	})
+}
+
+// NewTraceHandler возвращает хендлер, который отдаёт трейс билда build_id в формате Chrome trace_event.
+func NewTraceHandler(lookup func(buildID build.ID) *trace.Trace) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buildID build.ID
+		if err := buildID.UnmarshalText([]byte(r.URL.Query().Get("build_id"))); err != nil {
+			http.Error(w, fmt.Sprintf("invalid build_id: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		t := lookup(buildID)
+		if t == nil {
+			http.Error(w, fmt.Sprintf("build %s not found", buildID), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = t.WriteJSON(w)
+	})
+}
@@ -0,0 +1,97 @@
+package dist_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/dist"
+	"gitlab.com/slon/shad-go/distbuild/pkg/trace"
+)
+
+var testStatus = &api.ClusterStatus{
+	Workers: []api.WorkerStatus{
+		{
+			ID:            "http://worker0",
+			Labels:        map[string]string{"os": "linux"},
+			FreeSlots:     3,
+			RunningJobs:   []build.ID{{'a'}},
+			LastHeartbeat: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{ID: "http://worker1", Quarantined: true},
+	},
+	Builds: []api.BuildStatus{
+		{ID: build.ID{'b'}, Priority: 1, TotalJobs: 10, FinishedJobs: 4},
+	},
+	QueueLength: 6,
+}
+
+func TestStatusHandler_HTML(t *testing.T) {
+	h := dist.NewStatusHandler(func() *api.ClusterStatus { return testStatus })
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+
+	require.Equal(t, 200, w.Code)
+	require.Contains(t, w.Header().Get("Content-Type"), "text/html")
+
+	page := w.Body.String()
+	require.Contains(t, page, "<td>http://worker0</td>")
+	require.Contains(t, page, "os=linux")
+	require.Contains(t, page, "<td>3</td>")
+	require.Contains(t, page, "2024-01-01 12:00:00")
+	require.Contains(t, page, "quarantined")
+	require.Contains(t, page, build.ID{'b'}.String())
+	require.Contains(t, page, "<td>4/10</td>")
+	require.Contains(t, page, "6 jobs in queue")
+}
+
+func TestStatusHandler_JSON(t *testing.T) {
+	h := dist.NewStatusHandler(func() *api.ClusterStatus { return testStatus })
+
+	byQuery := httptest.NewRecorder()
+	h.ServeHTTP(byQuery, httptest.NewRequest("GET", "/status?format=json", nil))
+
+	req := httptest.NewRequest("GET", "/status", nil)
+	req.Header.Set("Accept", "application/json")
+	byAccept := httptest.NewRecorder()
+	h.ServeHTTP(byAccept, req)
+
+	for _, w := range []*httptest.ResponseRecorder{byQuery, byAccept} {
+		require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var status api.ClusterStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+		require.Equal(t, testStatus, &status)
+	}
+}
+
+func TestTraceHandler(t *testing.T) {
+	buildID := build.ID{'b'}
+	tr := trace.New(time.Now(), &build.Graph{})
+
+	h := dist.NewTraceHandler(func(id build.ID) *trace.Trace {
+		if id == buildID {
+			return tr
+		}
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/trace?build_id="+buildID.String(), nil))
+	require.Equal(t, 200, w.Code)
+	require.Contains(t, w.Body.String(), `"traceEvents"`)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/trace?build_id="+build.ID{'x'}.String(), nil))
+	require.Equal(t, 404, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/trace?build_id=foo", nil))
+	require.Equal(t, 400, w.Code)
+}
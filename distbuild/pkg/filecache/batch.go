@@ -0,0 +1,197 @@
+package filecache
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// Missing возвращает файлы из ids, которых нет в кеше.
+//
+// Файл, который прямо сейчас заливается, тоже считается отсутствующим: заливка может не завершиться.
+// Повторную заливку такого файла Receiver объединит с текущей.
+func (c *Cache) Missing(ids []build.ID) ([]build.ID, error) {
+	var missing []build.ID
+	for _, id := range ids {
+		_, unlock, err := c.Get(id)
+		switch {
+		case err == nil:
+			unlock()
+		case errors.Is(err, ErrNotFound), errors.Is(err, ErrWriteLocked):
+			missing = append(missing, id)
+		default:
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// WriteBatch сериализует файлы в tar поток, в котором имя каждой записи равно ID файла.
+//
+// files отображает ID файла в путь к нему на локальной файловой системе.
+func WriteBatch(w io.Writer, files map[build.ID]string) error {
+	ids := make([]build.ID, 0, len(files))
+	for id := range files {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+
+	tw := tar.NewWriter(w)
+	for _, id := range ids {
+		if err := writeBatchEntry(tw, id, files[id]); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeBatchEntry(tw *tar.Writer, id build.ID, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	h := &tar.Header{
+		Name:     id.String(),
+		Typeflag: tar.TypeReg,
+		Mode:     0666,
+		Size:     st.Size(),
+	}
+	if err = tw.WriteHeader(h); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Receiver записывает залитые файлы в кеш.
+//
+// Одновременные заливки одного и того же файла объединяются: содержимое записывает первая заливка,
+// а остальные дожидаются её завершения и отбрасывают свою копию. Если первая заливка не удалась,
+// следующая записывает файл из своего потока.
+type Receiver struct {
+	cache *Cache
+
+	mu      sync.Mutex
+	uploads map[build.ID]*upload
+}
+
+// upload is a write of a file that is in progress.
+type upload struct {
+	done    chan struct{}
+	err     error
+	waiters int
+}
+
+func NewReceiver(cache *Cache) *Receiver {
+	return &Receiver{cache: cache, uploads: map[build.ID]*upload{}}
+}
+
+func (r *Receiver) write(id build.ID, content io.Reader) (written bool, err error) {
+	w, abort, err := r.cache.Write(id)
+	if errors.Is(err, ErrExists) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if _, err = io.Copy(w, content); err != nil {
+		_ = abort()
+		return false, err
+	}
+	return true, w.Close()
+}
+
+// Receive записывает файл id с содержимым content.
+//
+// Receive возвращает true, если файл записан из content, и false, если файл залила другая заливка
+// или он уже был в кеше. Во втором случае content прочитан не до конца.
+func (r *Receiver) Receive(id build.ID, content io.Reader) (bool, error) {
+	for {
+		r.mu.Lock()
+		u, ok := r.uploads[id]
+		if !ok {
+			u = &upload{done: make(chan struct{})}
+			r.uploads[id] = u
+			r.mu.Unlock()
+
+			written, err := r.write(id, content)
+
+			r.mu.Lock()
+			u.err = err
+			delete(r.uploads, id)
+			r.mu.Unlock()
+
+			close(u.done)
+			return written, err
+		}
+
+		u.waiters++
+		r.mu.Unlock()
+
+		<-u.done
+		if u.err == nil {
+			return false, nil
+		}
+
+		// Concurrent upload failed, content of this upload is still unread.
+	}
+}
+
+// waiters returns the number of uploads waiting for the upload of id in progress.
+func (r *Receiver) waiters(id build.ID) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if u, ok := r.uploads[id]; ok {
+		return u.waiters
+	}
+	return 0
+}
+
+// ReceiveBatch читает tar поток, записанный WriteBatch, и возвращает файлы, записанные из этого потока.
+func (r *Receiver) ReceiveBatch(batch io.Reader) ([]build.ID, error) {
+	var written []build.ID
+
+	tr := tar.NewReader(batch)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return written, nil
+		} else if err != nil {
+			return written, err
+		}
+
+		var id build.ID
+		if err = id.UnmarshalText([]byte(h.Name)); err != nil {
+			return written, fmt.Errorf("invalid batch entry %q: %w", h.Name, err)
+		}
+
+		if h.Typeflag != tar.TypeReg {
+			return written, fmt.Errorf("invalid batch entry %q: unexpected type %q", h.Name, h.Typeflag)
+		}
+
+		ok, err := r.Receive(id, tr)
+		if err != nil {
+			return written, fmt.Errorf("file %s: %w", id, err)
+		}
+
+		if ok {
+			written = append(written, id)
+		}
+		// tar.Reader skips the unread part of the entry on the next call to Next.
+	}
+}
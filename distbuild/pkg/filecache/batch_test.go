@@ -0,0 +1,196 @@
+package filecache_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+)
+
+func readFile(t *testing.T, cache *testCache, id build.ID) string {
+	t.Helper()
+
+	path, unlock, err := cache.Get(id)
+	require.NoError(t, err)
+	defer unlock()
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func writeLocalFiles(t *testing.T, files map[build.ID]string) map[build.ID]string {
+	dir := t.TempDir()
+
+	paths := map[build.ID]string{}
+	for id, content := range files {
+		path := filepath.Join(dir, id.String())
+		require.NoError(t, os.WriteFile(path, []byte(content), 0666))
+		paths[id] = path
+	}
+	return paths
+}
+
+func TestBatchRoundTrip(t *testing.T) {
+	cache := newCache(t)
+	r := filecache.NewReceiver(cache.Cache)
+
+	files := writeLocalFiles(t, map[build.ID]string{
+		{01}: "foo",
+		{02}: "",
+		{03}: strings.Repeat("bar", 100000),
+	})
+
+	missing, err := cache.Missing([]build.ID{{01}, {02}, {03}})
+	require.NoError(t, err)
+	require.Len(t, missing, 3)
+
+	var batch bytes.Buffer
+	require.NoError(t, filecache.WriteBatch(&batch, files))
+
+	written, err := r.ReceiveBatch(bytes.NewReader(batch.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, []build.ID{{01}, {02}, {03}}, written)
+
+	require.Equal(t, "foo", readFile(t, cache, build.ID{01}))
+	require.Equal(t, "", readFile(t, cache, build.ID{02}))
+	require.Equal(t, strings.Repeat("bar", 100000), readFile(t, cache, build.ID{03}))
+
+	missing, err = cache.Missing([]build.ID{{01}, {04}})
+	require.NoError(t, err)
+	require.Equal(t, []build.ID{{04}}, missing)
+
+	// Files that are already in the cache are skipped.
+	written, err = r.ReceiveBatch(bytes.NewReader(batch.Bytes()))
+	require.NoError(t, err)
+	require.Empty(t, written)
+}
+
+func TestBatchInvalidEntry(t *testing.T) {
+	cache := newCache(t)
+	r := filecache.NewReceiver(cache.Cache)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "not-an-id"), []byte("foo"), 0666))
+
+	var batch bytes.Buffer
+	require.NoError(t, filecache.WriteBatch(&batch, map[build.ID]string{{01}: filepath.Join(dir, "not-an-id")}))
+
+	// Corrupt the name of the entry.
+	corrupted := bytes.Replace(batch.Bytes(), []byte(build.ID{01}.String()), []byte("../etc/passwd"), 1)
+	_, err := r.ReceiveBatch(bytes.NewReader(corrupted))
+	require.Error(t, err)
+}
+
+// blockingReader returns its content only after release is closed.
+type blockingReader struct {
+	r       io.Reader
+	started chan struct{}
+	release chan struct{}
+	err     error
+	once    sync.Once
+}
+
+func (b *blockingReader) Read(p []byte) (int, error) {
+	b.once.Do(func() { close(b.started) })
+	<-b.release
+
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.r.Read(p)
+}
+
+func newBlockingReader(content string, err error) *blockingReader {
+	return &blockingReader{
+		r:       strings.NewReader(content),
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+		err:     err,
+	}
+}
+
+func TestReceiverCollapsesConcurrentUploads(t *testing.T) {
+	cache := newCache(t)
+	r := filecache.NewReceiver(cache.Cache)
+	id := build.ID{01}
+
+	first := newBlockingReader("foo", nil)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	var firstWritten bool
+	go func() {
+		defer wg.Done()
+
+		var err error
+		firstWritten, err = r.Receive(id, first)
+		assert.NoError(t, err)
+	}()
+
+	<-first.started
+
+	second := strings.NewReader("foo")
+	secondDone := make(chan bool)
+	go func() {
+		written, err := r.Receive(id, second)
+		assert.NoError(t, err)
+		secondDone <- written
+	}()
+
+	// Release the first upload only after the second one joined it.
+	require.Eventually(t, func() bool {
+		return filecache.Waiters(r, id) == 1
+	}, time.Second, time.Millisecond)
+
+	close(first.release)
+	wg.Wait()
+
+	require.True(t, firstWritten)
+	require.False(t, <-secondDone)
+	require.Equal(t, "foo", readFile(t, cache, id))
+}
+
+func TestReceiverRetriesFailedUpload(t *testing.T) {
+	cache := newCache(t)
+	r := filecache.NewReceiver(cache.Cache)
+	id := build.ID{01}
+
+	errBroken := errors.New("connection reset")
+	first := newBlockingReader("", errBroken)
+
+	firstErr := make(chan error)
+	go func() {
+		_, err := r.Receive(id, first)
+		firstErr <- err
+	}()
+
+	<-first.started
+
+	secondDone := make(chan bool)
+	go func() {
+		written, err := r.Receive(id, strings.NewReader("foo"))
+		assert.NoError(t, err)
+		secondDone <- written
+	}()
+
+	close(first.release)
+	require.ErrorIs(t, <-firstErr, errBroken)
+
+	// Second upload either joined the failed one and retried with its own content,
+	// or started after the failure. In both cases the file comes from it.
+	require.True(t, <-secondDone)
+	require.Equal(t, "foo", readFile(t, cache, id))
+}
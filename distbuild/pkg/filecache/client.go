@@ -4,6 +4,7 @@ package filecache
 
 import (
 	"context"
+	"net/http"
 
 	"go.uber.org/zap"
 
@@ -17,6 +18,11 @@ func NewClient(l *zap.Logger, endpoint string) *Client {
 	panic("implement me")
 }
 
+// NewClientWithHTTPClient создаёт клиента, который делает все запросы через client.
+func NewClientWithHTTPClient(l *zap.Logger, endpoint string, client *http.Client) *Client {
+	panic("implement me")
+}
+
 func (c *Client) Upload(ctx context.Context, id build.ID, localPath string) error {
 	panic("implement me")
 }
@@ -24,3 +30,15 @@ func (c *Client) Upload(ctx context.Context, id build.ID, localPath string) erro
 func (c *Client) Download(ctx context.Context, localCache *Cache, id build.ID) error {
 	panic("implement me")
 }
+
+// MissingFiles возвращает файлы из ids, которых нет в кеше сервера, за один запрос.
+func (c *Client) MissingFiles(ctx context.Context, ids []build.ID) (missing []build.ID, err error) {
+	panic("implement me")
+}
+
+// UploadBatch заливает все файлы одним запросом. files отображает ID файла в путь к нему.
+//
+// Тело запроса записывается через WriteBatch.
+func (c *Client) UploadBatch(ctx context.Context, files map[build.ID]string) error {
+	panic("implement me")
+}
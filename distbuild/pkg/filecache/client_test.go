@@ -127,3 +127,36 @@ func TestFileDownload(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, []byte("foobar"), content)
 }
+
+func TestBatchUpload(t *testing.T) {
+	env := newEnv(t)
+	ctx := context.Background()
+
+	files := writeLocalFiles(t, map[build.ID]string{
+		{0x01}: "foo",
+		{0x02}: "bar",
+	})
+
+	missing, err := env.client.MissingFiles(ctx, []build.ID{{0x01}, {0x02}})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []build.ID{{0x01}, {0x02}}, missing)
+
+	require.NoError(t, env.client.UploadBatch(ctx, files))
+	require.Equal(t, "foo", readFile(t, env.cache, build.ID{0x01}))
+	require.Equal(t, "bar", readFile(t, env.cache, build.ID{0x02}))
+
+	missing, err = env.client.MissingFiles(ctx, []build.ID{{0x01}, {0x02}, {0x03}})
+	require.NoError(t, err)
+	require.Equal(t, []build.ID{{0x03}}, missing)
+
+	// Repeated and concurrent batches of the same files succeed.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, env.client.UploadBatch(ctx, files))
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,8 @@
+package filecache
+
+import "gitlab.com/slon/shad-go/distbuild/pkg/build"
+
+// Waiters returns the number of uploads of id that joined the upload in progress.
+func Waiters(r *Receiver, id build.ID) int {
+	return r.waiters(id)
+}
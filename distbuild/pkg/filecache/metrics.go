@@ -0,0 +1,10 @@
+package filecache
+
+import "gitlab.com/slon/shad-go/distbuild/pkg/metrics"
+
+var (
+	uploadedBytes = metrics.Default.Counter("distbuild_filecache_upload_bytes_total",
+		"Bytes of source files sent by Client.Upload.")
+	downloadedBytes = metrics.Default.Counter("distbuild_filecache_download_bytes_total",
+		"Bytes of source files received by Client.Download.")
+)
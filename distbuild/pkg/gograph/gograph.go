@@ -0,0 +1,763 @@
+package gograph
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+var ErrUnsupported = errors.New("unsupported package")
+
+// Config задаёт параметры загрузки модуля.
+type Config struct {
+	// Dir задаёт корень модуля. Пути в Graph.SourceFiles вычисляются относительно Dir,
+	// поэтому клиент должен запускать сборку с этой же директорией исходного кода.
+	Dir string
+
+	// Patterns задаёт список пакетов, которые нужно собрать. По умолчанию "./...".
+	Patterns []string
+
+	// CacheDir задаёт директорию на воркере, в которой go хранит GOCACHE и GOPATH.
+	// По умолчанию "/tmp/distbuild-go".
+	CacheDir string
+}
+
+type goEnv struct {
+	GOROOT    string
+	GOVERSION string
+	GOOS      string
+	GOARCH    string
+}
+
+type loader struct {
+	config Config
+	env    goEnv
+
+	goBin   string
+	environ []string
+	modPath string
+	lang    string
+
+	graph build.Graph
+
+	std         []string
+	stdJob      build.ID
+	compileJobs map[string]build.ID
+}
+
+// Load загружает go модуль и строит граф его сборки.
+//
+// Для каждого пакета модуля граф содержит джоб компиляции, джоб go vet, а для
+// main пакетов ещё и джоб линковки. Для пакетов с тестами граф содержит джоб, который
+// собирает и запускает тестовый бинарь. Пакеты стандартной библиотеки собираются
+// одним джобом, который копирует их из кеша go на воркере.
+//
+// Воркеры должны иметь тот же тулчейн, что и клиент, установленный в тот же GOROOT.
+// Зависимости вне основного модуля, cgo, ассемблер и go:embed не поддерживаются.
+func Load(ctx context.Context, config Config) (*build.Graph, error) {
+	if len(config.Patterns) == 0 {
+		config.Patterns = []string{"./..."}
+	}
+	if config.CacheDir == "" {
+		config.CacheDir = filepath.Join(os.TempDir(), "distbuild-go")
+	}
+
+	dir, err := filepath.Abs(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	config.Dir = dir
+
+	l := &loader{
+		config:      config,
+		compileJobs: map[string]build.ID{},
+		graph:       build.Graph{SourceFiles: map[build.ID]string{}},
+	}
+
+	if err := l.loadEnv(ctx); err != nil {
+		return nil, err
+	}
+
+	cfg := &packages.Config{
+		Context: ctx,
+		Dir:     config.Dir,
+		Env:     append(os.Environ(), "CGO_ENABLED=0", "GOFLAGS=-mod=mod"),
+		Tests:   true,
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps |
+			packages.NeedModule | packages.NeedEmbedPatterns,
+	}
+
+	roots, err := packages.Load(cfg, config.Patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load packages: %w", err)
+	}
+
+	if err := l.build(roots); err != nil {
+		return nil, err
+	}
+
+	if err := build.AssignIDs(&l.graph); err != nil {
+		return nil, err
+	}
+
+	return &l.graph, nil
+}
+
+func (l *loader) loadEnv(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "go", "env", "-json", "GOROOT", "GOVERSION", "GOOS", "GOARCH")
+	cmd.Dir = l.config.Dir
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("go env: %w: %s", err, stderr.String())
+	}
+
+	if err := json.Unmarshal(out, &l.env); err != nil {
+		return fmt.Errorf("go env: %w", err)
+	}
+
+	l.goBin = filepath.Join(l.env.GOROOT, "bin", "go")
+	l.environ = []string{
+		"PATH=" + filepath.Join(l.env.GOROOT, "bin") + ":/usr/bin:/bin",
+		"GOROOT=" + l.env.GOROOT,
+		"GOOS=" + l.env.GOOS,
+		"GOARCH=" + l.env.GOARCH,
+		"GOCACHE=" + filepath.Join(l.config.CacheDir, "cache"),
+		"GOPATH=" + filepath.Join(l.config.CacheDir, "path"),
+		"GOENV=off",
+		"GOTOOLCHAIN=local",
+		"CGO_ENABLED=0",
+	}
+	return nil
+}
+
+func isTestVariant(p *packages.Package) bool {
+	return strings.Contains(p.ID, " [")
+}
+
+func isTestMain(p *packages.Package) bool {
+	return !isTestVariant(p) && strings.HasSuffix(p.ID, ".test")
+}
+
+func isStd(p *packages.Package) bool {
+	return p.Module == nil && !isTestVariant(p) && !isTestMain(p)
+}
+
+func provisionalID(name string) build.ID {
+	return build.ID(sha1.Sum([]byte(name)))
+}
+
+func depPath(id build.ID) string {
+	return fmt.Sprintf("{{index .Deps %q}}", id.String())
+}
+
+func (l *loader) build(roots []*packages.Package) error {
+	var errs []error
+	var all []*packages.Package
+	std := []string{"runtime"}
+
+	packages.Visit(roots, nil, func(p *packages.Package) {
+		for _, err := range p.Errors {
+			errs = append(errs, err)
+		}
+
+		switch {
+		case isStd(p):
+			if p.PkgPath != "unsafe" && p.PkgPath != "runtime" {
+				std = append(std, p.PkgPath)
+			}
+		case isTestVariant(p) || isTestMain(p):
+		case !p.Module.Main:
+			errs = append(errs, fmt.Errorf("%w: %s is outside of the main module", ErrUnsupported, p.PkgPath))
+		}
+
+		all = append(all, p)
+	})
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	for _, p := range roots {
+		if p.Module != nil && p.Module.Main {
+			l.modPath = p.Module.Path
+			l.lang = p.Module.GoVersion
+		}
+	}
+	if l.lang != "" {
+		lang, err := languageVersion(l.lang)
+		if err != nil {
+			return err
+		}
+		l.lang = lang
+	}
+
+	l.addStdJob(std)
+
+	for _, p := range all {
+		if isStd(p) || isTestVariant(p) || isTestMain(p) {
+			continue
+		}
+
+		if err := l.addCompileJob(p); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range roots {
+		var err error
+		switch {
+		case isTestMain(p):
+			err = l.addTestJob(p)
+		case isTestVariant(p) || isStd(p):
+		default:
+			err = l.addVetJob(p)
+			if err == nil && p.Name == "main" {
+				err = l.addLinkJob(p)
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *loader) addJob(job build.Job) {
+	sort.Slice(job.Deps, func(i, j int) bool {
+		return bytes.Compare(job.Deps[i][:], job.Deps[j][:]) < 0
+	})
+	l.graph.Jobs = append(l.graph.Jobs, job)
+}
+
+// addStdJob adds a job that copies compiled standard library packages from the worker's go cache.
+//
+// Standard packages are laid out as {{.OutputDir}}/<import path>.a.
+func (l *loader) addStdJob(std []string) {
+	sort.Strings(std)
+	l.std = std
+
+	const script = `set -eo pipefail
+test "$(go env GOVERSION)" = "$1" || { echo "go toolchain mismatch: want $1, got $(go env GOVERSION)" >&2; exit 1; }
+out=$2
+shift 2
+go list -export -f '{{"{{.ImportPath}} {{.Export}}"}}' -deps "$@" | while read -r pkg export; do
+	[ -n "$export" ] || continue
+	mkdir -p "$out/$(dirname "$pkg")"
+	cp "$export" "$out/$pkg.a"
+done`
+
+	name := "stdlib " + l.env.GOVERSION
+	l.stdJob = provisionalID(name)
+
+	args := append([]string{"bash", "-c", script, "stdlib", l.env.GOVERSION, "{{.OutputDir}}"}, std...)
+	l.addJob(build.Job{
+		ID:   l.stdJob,
+		Name: name,
+		Cmds: []build.Cmd{
+			{Exec: args, Environ: l.environ, WorkingDirectory: "{{.OutputDir}}"},
+		},
+	})
+}
+
+func (l *loader) relPath(file string) (string, error) {
+	rel, err := filepath.Rel(l.config.Dir, file)
+	if err != nil {
+		return "", err
+	}
+
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%w: file %s is outside of the module root", ErrUnsupported, file)
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
+// addInputs registers files as job inputs and source files of the graph.
+//
+// Source file ID is a hash of the file path and its content, so files with equal content
+// at different paths get different IDs.
+func (l *loader) addInputs(job *build.Job, files []string) ([]string, error) {
+	var sources []string
+	for _, file := range files {
+		rel, err := l.relPath(file)
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		h := sha1.New()
+		_, _ = fmt.Fprintf(h, "%s\x00", rel)
+		_, _ = h.Write(content)
+
+		var id build.ID
+		copy(id[:], h.Sum(nil))
+
+		l.graph.SourceFiles[id] = rel
+		job.Inputs = append(job.Inputs, rel)
+		sources = append(sources, "{{.SourceDir}}/"+rel)
+	}
+	return sources, nil
+}
+
+// languageVersion converts go directive of go.mod into the -lang flag of the compiler.
+func languageVersion(goVersion string) (string, error) {
+	parts := strings.SplitN(goVersion, ".", 3)
+	if len(parts) < 2 {
+		return "", fmt.Errorf("%w: go version %q", ErrUnsupported, goVersion)
+	}
+	return "go" + parts[0] + "." + parts[1], nil
+}
+
+func packageDir(p *packages.Package) (string, error) {
+	if len(p.GoFiles) == 0 {
+		return "", fmt.Errorf("%w: %s has no go files", ErrUnsupported, p.PkgPath)
+	}
+	return filepath.Dir(p.GoFiles[0]), nil
+}
+
+func checkSupported(p *packages.Package) error {
+	switch {
+	case len(p.GoFiles) == 0:
+		return fmt.Errorf("%w: %s has no go files", ErrUnsupported, p.PkgPath)
+	case len(p.OtherFiles) != 0:
+		return fmt.Errorf("%w: %s contains non-go files %v", ErrUnsupported, p.PkgPath, p.OtherFiles)
+	case len(p.EmbedPatterns) != 0:
+		return fmt.Errorf("%w: %s uses go:embed", ErrUnsupported, p.PkgPath)
+	default:
+		return nil
+	}
+}
+
+// packageFile returns path to the compiled archive of p and ID of the job that produces it.
+func (l *loader) packageFile(p *packages.Package, local map[string]string) (string, build.ID, bool, error) {
+	if file, ok := local[p.ID]; ok {
+		return file, build.ID{}, true, nil
+	}
+
+	if isStd(p) {
+		return depPath(l.stdJob) + "/" + p.PkgPath + ".a", l.stdJob, false, nil
+	}
+
+	id, ok := l.compileJobs[p.ID]
+	if !ok {
+		return "", build.ID{}, false, fmt.Errorf("%w: %s is recompiled for test", ErrUnsupported, p.ID)
+	}
+	return depPath(id) + "/lib.a", id, false, nil
+}
+
+// importcfg renders importcfg for the given set of packages and adds producing jobs to job.Deps.
+//
+// local maps package ID to archives produced by the job itself.
+func (l *loader) importcfg(job *build.Job, imports map[string]*packages.Package, local map[string]string) (string, error) {
+	var lines []string
+	seen := map[build.ID]bool{}
+	for _, dep := range job.Deps {
+		seen[dep] = true
+	}
+
+	for importPath, p := range imports {
+		if importPath == "unsafe" {
+			continue
+		}
+
+		file, id, isLocal, err := l.packageFile(p, local)
+		if err != nil {
+			return "", err
+		}
+
+		if importPath != p.PkgPath {
+			lines = append(lines, fmt.Sprintf("importmap %s=%s", importPath, p.PkgPath))
+		}
+		lines = append(lines, fmt.Sprintf("packagefile %s=%s", p.PkgPath, file))
+
+		if !isLocal && !seen[id] {
+			seen[id] = true
+			job.Deps = append(job.Deps, id)
+		}
+	}
+
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// closure returns all packages that p depends on, keyed by package path.
+func closure(p *packages.Package) map[string]*packages.Package {
+	deps := map[string]*packages.Package{}
+	packages.Visit([]*packages.Package{p}, func(dep *packages.Package) bool {
+		if dep == p {
+			return true
+		}
+
+		if _, ok := deps[dep.PkgPath]; ok {
+			return false
+		}
+		deps[dep.PkgPath] = dep
+		return true
+	}, nil)
+	return deps
+}
+
+func (l *loader) compileCmds(
+	job *build.Job,
+	p *packages.Package,
+	sources []string,
+	suffix string,
+	local map[string]string,
+) ([]build.Cmd, error) {
+	importcfg := "{{.OutputDir}}/importcfg" + suffix
+	cfg, err := l.importcfg(job, p.Imports, local)
+	if err != nil {
+		return nil, err
+	}
+
+	pkgPath := p.PkgPath
+	if p.Name == "main" {
+		pkgPath = "main"
+	}
+
+	args := []string{
+		l.goBin, "tool", "compile",
+		"-p", pkgPath,
+		"-o", "{{.OutputDir}}/" + strings.TrimPrefix(suffix+".a", "."),
+		"-trimpath", "{{.SourceDir}}=>" + l.modPath,
+		"-importcfg", importcfg,
+		"-pack",
+	}
+	if l.lang != "" {
+		args = append(args, "-lang="+l.lang)
+	}
+	args = append(args, sources...)
+
+	return []build.Cmd{
+		{CatTemplate: cfg, CatOutput: importcfg},
+		{Exec: args, Environ: l.environ},
+	}, nil
+}
+
+func (l *loader) linkCmds(job *build.Job, p *packages.Package, main, output, suffix string, local map[string]string) ([]build.Cmd, error) {
+	importcfg := "{{.OutputDir}}/importcfg" + suffix
+	cfg, err := l.importcfg(job, closure(p), local)
+	if err != nil {
+		return nil, err
+	}
+
+	// Linker also needs implicit dependencies, like runtime, that are absent from the import graph.
+	for _, std := range l.std {
+		line := fmt.Sprintf("packagefile %s=%s/%s.a\n", std, depPath(l.stdJob), std)
+		if !strings.Contains(cfg, "packagefile "+std+"=") {
+			cfg += line
+		}
+	}
+	if !containsID(job.Deps, l.stdJob) {
+		job.Deps = append(job.Deps, l.stdJob)
+	}
+
+	return []build.Cmd{
+		{CatTemplate: cfg, CatOutput: importcfg},
+		{
+			Exec: []string{
+				l.goBin, "tool", "link",
+				"-o", output,
+				"-importcfg", importcfg,
+				"-buildmode=exe",
+				main,
+			},
+			Environ: l.environ,
+		},
+	}, nil
+}
+
+func (l *loader) addCompileJob(p *packages.Package) error {
+	if err := checkSupported(p); err != nil {
+		return err
+	}
+
+	job := build.Job{Name: "build " + p.PkgPath}
+	job.ID = provisionalID(job.Name)
+
+	sources, err := l.addInputs(&job, p.GoFiles)
+	if err != nil {
+		return err
+	}
+
+	job.Cmds, err = l.compileCmds(&job, p, sources, ".lib", nil)
+	if err != nil {
+		return err
+	}
+
+	l.compileJobs[p.ID] = job.ID
+	l.addJob(job)
+	return nil
+}
+
+func (l *loader) addLinkJob(p *packages.Package) error {
+	job := build.Job{Name: "link " + p.PkgPath}
+	job.ID = provisionalID(job.Name)
+
+	compileJob := l.compileJobs[p.ID]
+	job.Deps = append(job.Deps, compileJob)
+
+	var err error
+	job.Cmds, err = l.linkCmds(&job, p, depPath(compileJob)+"/lib.a", "{{.OutputDir}}/"+path.Base(p.PkgPath), "", nil)
+	if err != nil {
+		return err
+	}
+
+	l.addJob(job)
+	return nil
+}
+
+// vetConfig mirrors configuration that cmd/go passes to go tool vet.
+type vetConfig struct {
+	ID          string
+	Compiler    string
+	Dir         string
+	ImportPath  string
+	GoVersion   string
+	GoFiles     []string
+	ImportMap   map[string]string
+	PackageFile map[string]string
+	Standard    map[string]bool
+	VetxOutput  string
+}
+
+func (l *loader) addVetJob(p *packages.Package) error {
+	job := build.Job{Name: "vet " + p.PkgPath}
+	job.ID = provisionalID(job.Name)
+
+	sources, err := l.addInputs(&job, p.GoFiles)
+	if err != nil {
+		return err
+	}
+
+	dir, err := packageDir(p)
+	if err != nil {
+		return err
+	}
+
+	rel, err := l.relPath(dir)
+	if err != nil {
+		return err
+	}
+
+	cfg := vetConfig{
+		ID:          p.ID,
+		Compiler:    "gc",
+		Dir:         "{{.SourceDir}}/" + rel,
+		ImportPath:  p.PkgPath,
+		GoVersion:   l.lang,
+		GoFiles:     sources,
+		ImportMap:   map[string]string{},
+		PackageFile: map[string]string{},
+		Standard:    map[string]bool{},
+		VetxOutput:  "{{.OutputDir}}/vet.out",
+	}
+
+	// Template actions contain quotes, so they are substituted after json encoding.
+	actions := map[string]string{}
+	for importPath, dep := range p.Imports {
+		cfg.ImportMap[importPath] = dep.PkgPath
+		if importPath == "unsafe" {
+			continue
+		}
+
+		file, id, _, err := l.packageFile(dep, nil)
+		if err != nil {
+			return err
+		}
+
+		placeholder := fmt.Sprintf("$DEP%d$", len(actions))
+		actions[placeholder] = depPath(id)
+		file = placeholder + strings.TrimPrefix(file, depPath(id))
+
+		cfg.PackageFile[dep.PkgPath] = file
+		cfg.Standard[dep.PkgPath] = isStd(dep)
+
+		if !containsID(job.Deps, id) {
+			job.Deps = append(job.Deps, id)
+		}
+	}
+
+	js, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	cfgTemplate := string(js)
+	for placeholder, action := range actions {
+		cfgTemplate = strings.ReplaceAll(cfgTemplate, placeholder, action)
+	}
+
+	job.Cmds = []build.Cmd{
+		{CatTemplate: cfgTemplate, CatOutput: "{{.OutputDir}}/vet.cfg"},
+		{Exec: []string{l.goBin, "tool", "vet", "{{.OutputDir}}/vet.cfg"}, Environ: l.environ},
+	}
+
+	l.addJob(job)
+	return nil
+}
+
+func containsID(ids []build.ID, id build.ID) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
+
+// testdataFiles lists files from the testdata directory of the package.
+func testdataFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(filepath.Join(dir, "testdata"), func(path string, d fs.DirEntry, err error) error {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			return nil
+		case err != nil:
+			return err
+		case d.Type().IsRegular():
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// addTestJob adds a job that compiles the package together with its tests, links the test binary
+// and runs it inside the package directory.
+//
+// testMain is the synthesized "p.test" package returned by go/packages. Its source is generated by
+// the go command and is written into the output directory by a cat command.
+func (l *loader) addTestJob(testMain *packages.Package) error {
+	pkgPath := strings.TrimSuffix(testMain.PkgPath, ".test")
+
+	var internal, external *packages.Package
+	for _, p := range testMain.Imports {
+		switch {
+		case !isTestVariant(p):
+		case p.PkgPath == pkgPath:
+			internal = p
+		case p.PkgPath == pkgPath+"_test":
+			external = p
+		}
+	}
+
+	tested := internal
+	if tested == nil {
+		tested = external
+	}
+	if tested == nil {
+		return fmt.Errorf("%w: %s has no test packages", ErrUnsupported, testMain.ID)
+	}
+
+	job := build.Job{Name: "test " + pkgPath}
+	job.ID = provisionalID(job.Name)
+
+	local := map[string]string{}
+	for _, p := range []*packages.Package{internal, external} {
+		if p == nil {
+			continue
+		}
+
+		if err := checkSupported(p); err != nil {
+			return err
+		}
+
+		sources, err := l.addInputs(&job, p.GoFiles)
+		if err != nil {
+			return err
+		}
+
+		suffix := ".test"
+		if p == external {
+			suffix = ".xtest"
+		}
+
+		cmds, err := l.compileCmds(&job, p, sources, suffix, local)
+		if err != nil {
+			return err
+		}
+		job.Cmds = append(job.Cmds, cmds...)
+
+		local[p.ID] = "{{.OutputDir}}/" + strings.TrimPrefix(suffix, ".") + ".a"
+	}
+
+	dir, err := packageDir(tested)
+	if err != nil {
+		return err
+	}
+
+	testdata, err := testdataFiles(dir)
+	if err != nil {
+		return err
+	}
+	if _, err := l.addInputs(&job, testdata); err != nil {
+		return err
+	}
+
+	if len(testMain.GoFiles) != 1 {
+		return fmt.Errorf("%w: unexpected test main files %v", ErrUnsupported, testMain.GoFiles)
+	}
+
+	testMainSource, err := os.ReadFile(testMain.GoFiles[0])
+	if err != nil {
+		return err
+	}
+
+	job.Cmds = append(job.Cmds, build.Cmd{
+		CatTemplate: strings.ReplaceAll(string(testMainSource), "{{", `{{"{{"}}`),
+		CatOutput:   "{{.OutputDir}}/_testmain.go",
+	})
+
+	cmds, err := l.compileCmds(&job, testMain, []string{"{{.OutputDir}}/_testmain.go"}, ".main", local)
+	if err != nil {
+		return err
+	}
+	job.Cmds = append(job.Cmds, cmds...)
+
+	binary := "{{.OutputDir}}/" + path.Base(pkgPath) + ".test"
+	cmds, err = l.linkCmds(&job, testMain, "{{.OutputDir}}/main.a", binary, ".link", local)
+	if err != nil {
+		return err
+	}
+	job.Cmds = append(job.Cmds, cmds...)
+
+	rel, err := l.relPath(dir)
+	if err != nil {
+		return err
+	}
+
+	job.Cmds = append(job.Cmds, build.Cmd{
+		Exec:             []string{binary},
+		Environ:          l.environ,
+		WorkingDirectory: "{{.SourceDir}}/" + rel,
+	})
+
+	l.addJob(job)
+	return nil
+}
@@ -0,0 +1,122 @@
+package gograph_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/gograph"
+)
+
+func loadHello(t *testing.T) *build.Graph {
+	t.Helper()
+
+	g, err := gograph.Load(context.Background(), gograph.Config{Dir: "testdata/hello"})
+	require.NoError(t, err)
+	return g
+}
+
+func TestLoad(t *testing.T) {
+	g := loadHello(t)
+
+	require.NoError(t, g.Validate())
+	require.NoError(t, build.CheckIDs(*g))
+
+	names := map[string]bool{}
+	for _, job := range g.Jobs {
+		names[job.Name] = true
+	}
+
+	for _, name := range []string{
+		"build example.com/hello",
+		"build example.com/hello/greet",
+		"vet example.com/hello",
+		"vet example.com/hello/greet",
+		"link example.com/hello",
+		"test example.com/hello/greet",
+	} {
+		require.Truef(t, names[name], "job %q is missing", name)
+	}
+
+	again := loadHello(t)
+	require.Equal(t, g, again)
+}
+
+// runGraph executes the graph locally, the same way a worker would.
+func runGraph(t *testing.T, g *build.Graph, sourceDir string) map[build.ID][]byte {
+	outputDirs := map[build.ID]string{}
+	stdout := map[build.ID][]byte{}
+
+	for _, job := range build.TopSort(g.Jobs) {
+		outputDir := filepath.Join(t.TempDir(), "out")
+		require.NoError(t, os.Mkdir(outputDir, 0777))
+		outputDirs[job.ID] = outputDir
+
+		jobCtx := build.JobContext{SourceDir: sourceDir, OutputDir: outputDir, Deps: map[build.ID]string{}}
+		for _, dep := range job.Deps {
+			jobCtx.Deps[dep] = outputDirs[dep]
+		}
+
+		for _, cmd := range job.Cmds {
+			rendered, err := cmd.Render(jobCtx)
+			require.NoError(t, err)
+
+			if rendered.CatOutput != "" {
+				require.NoError(t, os.WriteFile(rendered.CatOutput, []byte(rendered.CatTemplate), 0666))
+				continue
+			}
+
+			var out, stderr bytes.Buffer
+			c := exec.Command(rendered.Exec[0], rendered.Exec[1:]...)
+			c.Env = rendered.Environ
+			c.Dir = rendered.WorkingDirectory
+			c.Stdout = &out
+			c.Stderr = &stderr
+			require.NoErrorf(t, c.Run(), "job %q failed: %s", job.Name, stderr.String())
+
+			stdout[job.ID] = append(stdout[job.ID], out.Bytes()...)
+		}
+	}
+
+	for _, job := range g.Jobs {
+		if job.Name == "link example.com/hello" {
+			out, err := exec.Command(filepath.Join(outputDirs[job.ID], "hello")).Output()
+			require.NoError(t, err)
+			stdout[job.ID] = out
+		}
+	}
+
+	return stdout
+}
+
+func TestBuildGraph(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiles standard library")
+	}
+
+	g := loadHello(t)
+
+	sourceDir, err := filepath.Abs("testdata/hello")
+	require.NoError(t, err)
+
+	stdout := runGraph(t, g, sourceDir)
+	for _, job := range g.Jobs {
+		switch job.Name {
+		case "link example.com/hello":
+			require.Equal(t, "hello, world\n", string(stdout[job.ID]))
+		case "test example.com/hello/greet":
+			require.Equal(t, "PASS\n", string(stdout[job.ID]))
+		}
+	}
+}
+
+func TestLoadTestOnlyPackage(t *testing.T) {
+	_, err := gograph.Load(context.Background(), gograph.Config{Dir: "testdata/testonly"})
+	require.ErrorIs(t, err, gograph.ErrUnsupported)
+}
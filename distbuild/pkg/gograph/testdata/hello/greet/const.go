@@ -0,0 +1,3 @@
+package greet
+
+const greeting = "hello"
@@ -0,0 +1,9 @@
+package greet
+
+import "testing"
+
+func TestGreeting(t *testing.T) {
+	if greeting != "hello" {
+		t.Errorf("unexpected greeting %q", greeting)
+	}
+}
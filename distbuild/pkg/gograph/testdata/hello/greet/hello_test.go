@@ -0,0 +1,20 @@
+package greet_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"example.com/hello/greet"
+)
+
+func TestHello(t *testing.T) {
+	name, err := os.ReadFile("testdata/name.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := greet.Hello(strings.TrimSpace(string(name))); got != "hello, gopher" {
+		t.Errorf("unexpected greeting %q", got)
+	}
+}
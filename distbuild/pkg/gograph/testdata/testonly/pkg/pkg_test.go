@@ -0,0 +1,5 @@
+package pkg
+
+import "testing"
+
+func TestNothing(t *testing.T) {}
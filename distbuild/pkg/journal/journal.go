@@ -0,0 +1,427 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+const fileName = "journal"
+
+// DefaultCompactThreshold задаёт размер журнала, после которого Open сжимает его во время работы.
+const DefaultCompactThreshold = 64 << 20
+
+var ErrCorrupted = errors.New("journal is corrupted")
+
+// record is a single line of the journal. Exactly one field is set.
+type record struct {
+	BuildStarted    *buildStarted   `json:",omitempty"`
+	StatusUpdate    *statusUpdate   `json:",omitempty"`
+	ArtifactAdded   *artifactChange `json:",omitempty"`
+	ArtifactEvicted *artifactChange `json:",omitempty"`
+}
+
+type buildStarted struct {
+	ID      build.ID
+	Request *api.BuildRequest
+}
+
+type statusUpdate struct {
+	ID     build.ID
+	Update *api.StatusUpdate
+}
+
+type artifactChange struct {
+	WorkerID   api.WorkerID
+	ArtifactID build.ID
+}
+
+// BuildState описывает билд, восстановленный из журнала.
+type BuildState struct {
+	Request *api.BuildRequest
+
+	// Updates хранит сообщения, отправленные клиенту, в порядке отправки. Куски вывода JobOutput
+	// завершённого джоба отбрасываются, потому что его полный вывод повторяется в JobFinished.
+	Updates []api.StatusUpdate
+
+	// Done выставлен, если билд завершился сообщением BuildFinished или BuildFailed.
+	Done bool
+}
+
+// State описывает состояние координатора, восстановленное из журнала.
+type State struct {
+	Builds map[build.ID]*BuildState
+
+	// Artifacts хранит, на каких воркерах лежат артефакты.
+	Artifacts map[build.ID]map[api.WorkerID]struct{}
+}
+
+func newState() *State {
+	return &State{
+		Builds:    map[build.ID]*BuildState{},
+		Artifacts: map[build.ID]map[api.WorkerID]struct{}{},
+	}
+}
+
+// check reports whether r can be applied to s.
+func (s *State) check(r *record) error {
+	switch {
+	case r.BuildStarted != nil, r.ArtifactAdded != nil, r.ArtifactEvicted != nil:
+		return nil
+
+	case r.StatusUpdate != nil:
+		if _, ok := s.Builds[r.StatusUpdate.ID]; !ok {
+			return fmt.Errorf("%w: update of unknown build %v", ErrCorrupted, r.StatusUpdate.ID)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("%w: empty record", ErrCorrupted)
+	}
+}
+
+func (s *State) apply(r *record) error {
+	if err := s.check(r); err != nil {
+		return err
+	}
+
+	switch {
+	case r.BuildStarted != nil:
+		s.Builds[r.BuildStarted.ID] = &BuildState{Request: r.BuildStarted.Request}
+
+	case r.StatusUpdate != nil:
+		b := s.Builds[r.StatusUpdate.ID]
+		update := r.StatusUpdate.Update
+		if update.JobFinished != nil {
+			b.dropOutput(update.JobFinished.ID)
+		}
+
+		b.Updates = append(b.Updates, *update)
+		if update.BuildFinished != nil || update.BuildFailed != nil {
+			b.Done = true
+		}
+
+	case r.ArtifactAdded != nil:
+		workers, ok := s.Artifacts[r.ArtifactAdded.ArtifactID]
+		if !ok {
+			workers = map[api.WorkerID]struct{}{}
+			s.Artifacts[r.ArtifactAdded.ArtifactID] = workers
+		}
+		workers[r.ArtifactAdded.WorkerID] = struct{}{}
+
+	case r.ArtifactEvicted != nil:
+		workers := s.Artifacts[r.ArtifactEvicted.ArtifactID]
+		delete(workers, r.ArtifactEvicted.WorkerID)
+		if len(workers) == 0 {
+			delete(s.Artifacts, r.ArtifactEvicted.ArtifactID)
+		}
+	}
+
+	return nil
+}
+
+// dropOutput removes output chunks of the finished job, its JobFinished repeats the whole output.
+func (b *BuildState) dropOutput(jobID build.ID) {
+	updates := b.Updates[:0]
+	for _, u := range b.Updates {
+		if u.JobOutput == nil || u.JobOutput.ID != jobID {
+			updates = append(updates, u)
+		}
+	}
+	b.Updates = updates
+}
+
+// Journal - журнал упреждающей записи координатора.
+//
+// Журнал хранит билды, сообщения о прогрессе билдов и расположение артефактов. Каждая запись,
+// кроме кусков вывода JobOutput, сбрасывается на диск до возврата из метода, поэтому после падения
+// координатора журнал содержит все остальные сообщения, которые координатор успел отправить клиентам.
+// Куски вывода попадают на диск вместе со следующей такой записью: при падении машины
+// они могут потеряться, но полный вывод джоба всё равно хранится в JobFinished.
+//
+// Когда журнал вырастает больше порога сжатия и вдвое больше, чем после прошлого сжатия,
+// он сжимается так же, как в Open.
+//
+// Все методы Journal concurrency safe.
+type Journal struct {
+	path      string
+	threshold int64
+
+	mu sync.Mutex
+	f  *os.File
+
+	// live mirrors the content of the journal, it is written back on compaction.
+	live *State
+
+	size, compacted int64
+
+	// broken is set when a torn record could not be removed from the end of the file.
+	broken error
+}
+
+// Open открывает журнал в директории dir и восстанавливает из него состояние.
+//
+// Запись, оборванная при падении, отбрасывается. Перед началом работы журнал сжимается:
+// в нём остаются только незавершённые билды и текущее расположение артефактов.
+func Open(dir string) (*Journal, *State, error) {
+	return OpenWithCompactThreshold(dir, DefaultCompactThreshold)
+}
+
+// OpenWithCompactThreshold работает как Open, но сжимает журнал во время работы
+// после достижения размера threshold байт.
+func OpenWithCompactThreshold(dir string, threshold int64) (*Journal, *State, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, nil, err
+	}
+
+	path := filepath.Join(dir, fileName)
+	state, err := replay(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	dropFinished(state)
+
+	j := &Journal{path: path, threshold: threshold}
+	if err := j.compact(state); err != nil {
+		return nil, nil, err
+	}
+
+	// Journal keeps its own copy of the state, the caller owns the returned one.
+	j.live, err = replay(path)
+	if err != nil {
+		_ = j.f.Close()
+		return nil, nil, err
+	}
+
+	return j, state, nil
+}
+
+// dropFinished removes finished builds, they are not needed for recovery.
+func dropFinished(state *State) {
+	for id, b := range state.Builds {
+		if b.Done {
+			delete(state.Builds, id)
+		}
+	}
+}
+
+func replay(path string) (*State, error) {
+	state := newState()
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// Partial last line is a record torn by the crash.
+			return state, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			if _, peekErr := r.Peek(1); peekErr == io.EOF {
+				// Garbage in the last line is a torn record too.
+				return state, nil
+			}
+			return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+
+		if err := state.apply(&rec); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func writeRecord(w io.Writer, rec *record) (int, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(rec); err != nil {
+		return 0, err
+	}
+	return w.Write(buf.Bytes())
+}
+
+// compact rewrites the journal, so that it contains only records required to restore state.
+func compact(path string, state *State) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp) }()
+
+	w := bufio.NewWriter(f)
+	write := func() error {
+		for id, b := range state.Builds {
+			if _, err := writeRecord(w, &record{BuildStarted: &buildStarted{ID: id, Request: b.Request}}); err != nil {
+				return err
+			}
+
+			finished := map[build.ID]bool{}
+			for _, u := range b.Updates {
+				if u.JobFinished != nil {
+					finished[u.JobFinished.ID] = true
+				}
+			}
+
+			for i := range b.Updates {
+				// Output that arrived after JobFinished is repeated in it as well.
+				if out := b.Updates[i].JobOutput; out != nil && finished[out.ID] {
+					continue
+				}
+
+				if _, err := writeRecord(w, &record{StatusUpdate: &statusUpdate{ID: id, Update: &b.Updates[i]}}); err != nil {
+					return err
+				}
+			}
+		}
+
+		for artifactID, workers := range state.Artifacts {
+			for workerID := range workers {
+				if _, err := writeRecord(w, &record{ArtifactAdded: &artifactChange{WorkerID: workerID, ArtifactID: artifactID}}); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}
+
+	if err := write(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// compact rewrites the journal from state and reopens it for appending.
+//
+// Old file stays open until the new one is ready, so the journal remains usable if compaction fails.
+func (j *Journal) compact(state *State) error {
+	if err := compact(j.path, state); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if j.f != nil {
+		_ = j.f.Close()
+	}
+	j.f = f
+	j.size = info.Size()
+	j.compacted = info.Size()
+	return nil
+}
+
+func (j *Journal) append(rec *record) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return os.ErrClosed
+	}
+	if j.broken != nil {
+		return j.broken
+	}
+
+	if err := j.live.check(rec); err != nil {
+		return err
+	}
+
+	n, err := writeRecord(j.f, rec)
+	if err != nil {
+		if n != 0 {
+			// Remove the torn record, so that the next record doesn't get glued to it.
+			if truncErr := j.f.Truncate(j.size); truncErr != nil {
+				j.broken = fmt.Errorf("journal is broken: %w", errors.Join(err, truncErr))
+				return j.broken
+			}
+		}
+		return err
+	}
+
+	// Live state changes only after the record is written, so that compaction doesn't resurrect failed records.
+	if err = j.live.apply(rec); err != nil {
+		return err
+	}
+	j.size += int64(n)
+
+	if rec.StatusUpdate == nil || rec.StatusUpdate.Update.JobOutput == nil {
+		if err = j.f.Sync(); err != nil {
+			return err
+		}
+	}
+
+	if j.size >= j.threshold && j.size >= 2*j.compacted {
+		dropFinished(j.live)
+		return j.compact(j.live)
+	}
+	return nil
+}
+
+// BuildStarted записывает начало нового билда.
+func (j *Journal) BuildStarted(id build.ID, req *api.BuildRequest) error {
+	return j.append(&record{BuildStarted: &buildStarted{ID: id, Request: req}})
+}
+
+// StatusUpdated записывает сообщение о прогрессе билда. Координатор должен вызывать этот
+// метод до того, как отправит сообщение клиенту.
+func (j *Journal) StatusUpdated(id build.ID, update *api.StatusUpdate) error {
+	return j.append(&record{StatusUpdate: &statusUpdate{ID: id, Update: update}})
+}
+
+// ArtifactAdded записывает, что артефакт появился в кеше воркера.
+func (j *Journal) ArtifactAdded(workerID api.WorkerID, artifactID build.ID) error {
+	return j.append(&record{ArtifactAdded: &artifactChange{WorkerID: workerID, ArtifactID: artifactID}})
+}
+
+// ArtifactEvicted записывает, что артефакт был удалён из кеша воркера.
+func (j *Journal) ArtifactEvicted(workerID api.WorkerID, artifactID build.ID) error {
+	return j.append(&record{ArtifactEvicted: &artifactChange{WorkerID: workerID, ArtifactID: artifactID}})
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return nil
+	}
+
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
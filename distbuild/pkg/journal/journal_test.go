@@ -0,0 +1,153 @@
+package journal_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/journal"
+)
+
+var (
+	running  = build.ID{'r'}
+	finished = build.ID{'f'}
+
+	request = &api.BuildRequest{
+		Graph: build.Graph{Jobs: []build.Job{{ID: build.ID{'a'}, Name: "echo"}}},
+	}
+)
+
+func fill(t *testing.T, j *journal.Journal) {
+	require.NoError(t, j.BuildStarted(running, request))
+	require.NoError(t, j.BuildStarted(finished, request))
+
+	require.NoError(t, j.StatusUpdated(running, &api.StatusUpdate{JobFinished: &api.JobResult{ID: build.ID{'a'}, Stdout: []byte("OK\n")}}))
+	require.NoError(t, j.StatusUpdated(finished, &api.StatusUpdate{BuildFinished: &api.BuildFinished{}}))
+
+	require.NoError(t, j.ArtifactAdded("w0", build.ID{'a'}))
+	require.NoError(t, j.ArtifactAdded("w1", build.ID{'a'}))
+	require.NoError(t, j.ArtifactAdded("w0", build.ID{'b'}))
+	require.NoError(t, j.ArtifactEvicted("w0", build.ID{'b'}))
+}
+
+func checkState(t *testing.T, state *journal.State) {
+	require.Equal(t, map[build.ID]*journal.BuildState{
+		running: {
+			Request: request,
+			Updates: []api.StatusUpdate{{JobFinished: &api.JobResult{ID: build.ID{'a'}, Stdout: []byte("OK\n")}}},
+		},
+	}, state.Builds)
+
+	require.Equal(t, map[build.ID]map[api.WorkerID]struct{}{
+		{'a'}: {"w0": {}, "w1": {}},
+	}, state.Artifacts)
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	j, state, err := journal.Open(dir)
+	require.NoError(t, err)
+	require.Empty(t, state.Builds)
+
+	fill(t, j)
+	require.NoError(t, j.Close())
+
+	j, state, err = journal.Open(dir)
+	require.NoError(t, err)
+	checkState(t, state)
+
+	// Journal stays usable after compaction.
+	require.NoError(t, j.ArtifactEvicted("w1", build.ID{'a'}))
+	require.NoError(t, j.Close())
+
+	_, state, err = journal.Open(dir)
+	require.NoError(t, err)
+	require.Equal(t, map[build.ID]map[api.WorkerID]struct{}{{'a'}: {"w0": {}}}, state.Artifacts)
+}
+
+func TestTornRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	j, _, err := journal.Open(dir)
+	require.NoError(t, err)
+	fill(t, j)
+	require.NoError(t, j.Close())
+
+	f, err := os.OpenFile(filepath.Join(dir, "journal"), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"ArtifactAdded":{"WorkerID":"w2","Artif`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	j, state, err := journal.Open(dir)
+	require.NoError(t, err)
+	checkState(t, state)
+	require.NoError(t, j.Close())
+}
+
+func TestCorruptedJournal(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "journal"), []byte("garbage\n{}\n"), 0666))
+
+	_, _, err := journal.Open(dir)
+	require.ErrorIs(t, err, journal.ErrCorrupted)
+}
+
+func TestCompactWhileRunning(t *testing.T) {
+	dir := t.TempDir()
+
+	j, _, err := journal.OpenWithCompactThreshold(dir, 4<<10)
+	require.NoError(t, err)
+
+	fill(t, j)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, j.ArtifactAdded("w2", build.ID{'c'}))
+		require.NoError(t, j.ArtifactEvicted("w2", build.ID{'c'}))
+		require.NoError(t, j.StatusUpdated(running, &api.StatusUpdate{JobOutput: &api.JobOutput{ID: build.ID{'a'}, Data: []byte("OK\n")}}))
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "journal"))
+	require.NoError(t, err)
+	require.Less(t, info.Size(), int64(8<<10))
+	require.NoError(t, j.Close())
+
+	j, state, err := journal.Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, j.Close())
+
+	// Finished build is dropped, output of the finished job is dropped up to the last compaction.
+	require.Len(t, state.Builds, 1)
+	require.Less(t, len(state.Builds[running].Updates), 100)
+	require.Equal(t, map[build.ID]map[api.WorkerID]struct{}{
+		{'a'}: {"w0": {}, "w1": {}},
+	}, state.Artifacts)
+}
+
+func TestFinishedJobOutputDropped(t *testing.T) {
+	dir := t.TempDir()
+
+	j, _, err := journal.Open(dir)
+	require.NoError(t, err)
+	fill(t, j)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, j.StatusUpdated(running, &api.StatusUpdate{JobOutput: &api.JobOutput{ID: build.ID{'b'}, Data: []byte("OK\n")}}))
+	}
+	require.NoError(t, j.StatusUpdated(running, &api.StatusUpdate{JobFinished: &api.JobResult{ID: build.ID{'b'}}}))
+	require.NoError(t, j.Close())
+
+	j, state, err := journal.Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, j.Close())
+
+	require.Equal(t, []api.StatusUpdate{
+		{JobFinished: &api.JobResult{ID: build.ID{'a'}, Stdout: []byte("OK\n")}},
+		{JobFinished: &api.JobResult{ID: build.ID{'b'}}},
+	}, state.Builds[running].Updates)
+}
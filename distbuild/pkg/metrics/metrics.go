@@ -0,0 +1,310 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets подходят для длительностей в секундах от миллисекунд до минут.
+var DefaultBuckets = []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60, 300}
+
+// Default содержит метрики всего процесса. Компоненты системы регистрируют свои метрики в Default,
+// а программы из cmd отдают его по /metrics.
+var Default = NewRegistry()
+
+// atomicFloat хранит float64 в виде битов, чтобы обновлять его без мьютекса.
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) Add(delta float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) Set(v float64) {
+	f.bits.Store(math.Float64bits(v))
+}
+
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// Counter задаёт монотонно растущий счётчик.
+type Counter struct {
+	v atomicFloat
+}
+
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add увеличивает счётчик на delta. Отрицательный delta приводит к панике.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.Add(delta)
+}
+
+func (c *Counter) Value() float64 {
+	return c.v.Load()
+}
+
+// Gauge задаёт значение, которое может как расти, так и уменьшаться.
+type Gauge struct {
+	v atomicFloat
+}
+
+func (g *Gauge) Set(v float64) {
+	g.v.Set(v)
+}
+
+func (g *Gauge) Add(delta float64) {
+	g.v.Add(delta)
+}
+
+func (g *Gauge) Inc() {
+	g.v.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.v.Add(-1)
+}
+
+func (g *Gauge) Value() float64 {
+	return g.v.Load()
+}
+
+// Histogram считает распределение наблюдаемых значений по корзинам.
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64
+	count   atomic.Uint64
+	sum     atomicFloat
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.counts) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	h.sum.Add(v)
+}
+
+// ObserveDuration добавляет длительность d в секундах.
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+type metric struct {
+	name, help string
+	kind       string
+
+	counter   *Counter
+	gauge     *Gauge
+	gaugeFunc []*gaugeSource
+	histogram *Histogram
+}
+
+// Registry хранит метрики по имени и сериализует их в текстовом формате Prometheus.
+//
+// Методы регистрации возвращают уже существующую метрику, если метрика с таким именем
+// и типом зарегистрирована раньше. Все методы Registry concurrency safe.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]*metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]*metric{}}
+}
+
+func (r *Registry) register(name, help, kind string, create func(m *metric)) *metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if m, ok := r.metrics[name]; ok {
+		if m.kind != kind {
+			panic(fmt.Sprintf("metrics: %s is already registered as %s", name, m.kind))
+		}
+		return m
+	}
+
+	m := &metric{name: name, help: help, kind: kind}
+	create(m)
+	r.metrics[name] = m
+	return m
+}
+
+func (r *Registry) Counter(name, help string) *Counter {
+	return r.register(name, help, "counter", func(m *metric) {
+		m.counter = &Counter{}
+	}).counter
+}
+
+func (r *Registry) Gauge(name, help string) *Gauge {
+	return r.register(name, help, "gauge", func(m *metric) {
+		m.gauge = &Gauge{}
+	}).gauge
+}
+
+type gaugeSource struct {
+	f func() float64
+}
+
+// GaugeFunc регистрирует gauge, значение которого вычисляется в момент сериализации.
+//
+// Под одним именем можно зарегистрировать несколько функций, значение gauge равно их сумме.
+// Так несколько воркеров или координаторов в одном процессе сообщают общее значение.
+// Возвращённая функция удаляет f из суммы, её нужно вызвать, когда владелец f останавливается.
+func (r *Registry) GaugeFunc(name, help string, f func() float64) (unregister func()) {
+	m := r.register(name, help, "gaugefunc", func(m *metric) {})
+	source := &gaugeSource{f: f}
+
+	r.mu.Lock()
+	m.gaugeFunc = append(m.gaugeFunc, source)
+	r.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			for i, s := range m.gaugeFunc {
+				if s == source {
+					m.gaugeFunc = append(m.gaugeFunc[:i:i], m.gaugeFunc[i+1:]...)
+					break
+				}
+			}
+		})
+	}
+}
+
+// Histogram регистрирует гистограмму с верхними границами корзин buckets, отсортированными по возрастанию.
+func (r *Registry) Histogram(name, help string, buckets []float64) *Histogram {
+	return r.register(name, help, "histogram", func(m *metric) {
+		m.histogram = &Histogram{
+			buckets: buckets,
+			counts:  make([]atomic.Uint64, len(buckets)),
+		}
+	}).histogram
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// WriteText пишет все метрики в w в текстовом формате Prometheus, упорядочив их по имени.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := make([]*metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name < metrics[j].name
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, m.help)
+		kind := m.kind
+		if kind == "gaugefunc" {
+			kind = "gauge"
+		}
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, kind)
+
+		switch {
+		case m.counter != nil:
+			fmt.Fprintf(bw, "%s %s\n", m.name, formatFloat(m.counter.Value()))
+
+		case m.gauge != nil:
+			fmt.Fprintf(bw, "%s %s\n", m.name, formatFloat(m.gauge.Value()))
+
+		case m.histogram != nil:
+			h := m.histogram
+
+			var cumulative uint64
+			for i, le := range h.buckets {
+				cumulative += h.counts[i].Load()
+				fmt.Fprintf(bw, "%s_bucket{le=%q} %d\n", m.name, formatFloat(le), cumulative)
+			}
+
+			count := h.count.Load()
+			fmt.Fprintf(bw, "%s_bucket{le=\"+Inf\"} %d\n", m.name, count)
+			fmt.Fprintf(bw, "%s_sum %s\n", m.name, formatFloat(h.sum.Load()))
+			fmt.Fprintf(bw, "%s_count %d\n", m.name, count)
+
+		default:
+			r.mu.Lock()
+			sources := m.gaugeFunc
+			r.mu.Unlock()
+
+			var sum float64
+			for _, s := range sources {
+				sum += s.f()
+			}
+			fmt.Fprintf(bw, "%s %s\n", m.name, formatFloat(sum))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ServeHTTP отдаёт метрики в текстовом формате Prometheus.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WriteText(w)
+}
+
+// CountingReader увеличивает счётчик на число байт, прочитанных из R.
+type CountingReader struct {
+	R       io.Reader
+	Counter *Counter
+}
+
+func (r *CountingReader) Read(p []byte) (int, error) {
+	n, err := r.R.Read(p)
+	r.Counter.Add(float64(n))
+	return n, err
+}
+
+// CountingWriter увеличивает счётчик на число байт, записанных в W.
+type CountingWriter struct {
+	W       io.Writer
+	Counter *Counter
+}
+
+func (w *CountingWriter) Write(p []byte) (int, error) {
+	n, err := w.W.Write(p)
+	w.Counter.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,114 @@
+package metrics_test
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/metrics"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := metrics.NewRegistry()
+
+	r.Counter("test_bytes_total", "Bytes transferred.").Add(1024)
+	r.Gauge("test_running", "Running jobs.").Set(3)
+	r.GaugeFunc("test_queue", "Queue depth.", func() float64 { return 7 })
+
+	h := r.Histogram("test_duration_seconds", "Duration.", []float64{0.1, 1})
+	h.ObserveDuration(50 * time.Millisecond)
+	h.Observe(1)
+	h.Observe(5)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+
+	require.Equal(t, `# HELP test_bytes_total Bytes transferred.
+# TYPE test_bytes_total counter
+test_bytes_total 1024
+# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{le="0.1"} 1
+test_duration_seconds_bucket{le="1"} 2
+test_duration_seconds_bucket{le="+Inf"} 3
+test_duration_seconds_sum 6.05
+test_duration_seconds_count 3
+# HELP test_queue Queue depth.
+# TYPE test_queue gauge
+test_queue 7
+# HELP test_running Running jobs.
+# TYPE test_running gauge
+test_running 3
+`, buf.String())
+}
+
+func TestRegistry_Reregister(t *testing.T) {
+	r := metrics.NewRegistry()
+
+	c := r.Counter("test_total", "")
+	require.Same(t, c, r.Counter("test_total", ""))
+
+	require.Panics(t, func() { r.Gauge("test_total", "") })
+	require.Panics(t, func() { c.Add(-1) })
+
+	unregister := r.GaugeFunc("test_func", "", func() float64 { return 1 })
+	r.GaugeFunc("test_func", "", func() float64 { return 2 })
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	require.Contains(t, buf.String(), "test_func 3\n")
+
+	unregister()
+	unregister()
+
+	buf.Reset()
+	require.NoError(t, r.WriteText(&buf))
+	require.Contains(t, buf.String(), "test_func 2\n")
+}
+
+func TestCounter_Concurrent(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := r.Counter("test_total", "")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, float64(10000), c.Value())
+}
+
+func TestCountingReader(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := r.Counter("test_bytes_total", "")
+
+	_, err := io.Copy(&metrics.CountingWriter{W: io.Discard, Counter: c},
+		&metrics.CountingReader{R: strings.NewReader("hello"), Counter: c})
+	require.NoError(t, err)
+	require.Equal(t, float64(10), c.Value())
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.Counter("test_total", "Test.").Inc()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	require.Equal(t, 200, w.Code)
+	require.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	require.Contains(t, w.Body.String(), "test_total 1\n")
+}
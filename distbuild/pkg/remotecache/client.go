@@ -0,0 +1,185 @@
+package remotecache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/tarstream"
+)
+
+// Client ходит в удалённый кеш результатов джобов.
+//
+// Ключом в кеше служит ID джоба, а значением - его выходная директория.
+type Client struct {
+	l        *zap.Logger
+	endpoint string
+	client   *http.Client
+}
+
+func NewClient(l *zap.Logger, endpoint string) *Client {
+	return NewClientWithHTTPClient(l, endpoint, http.DefaultClient)
+}
+
+// NewClientWithHTTPClient создаёт клиента, который делает все запросы через client.
+func NewClientWithHTTPClient(l *zap.Logger, endpoint string, client *http.Client) *Client {
+	return &Client{l: l, endpoint: endpoint, client: client}
+}
+
+func (c *Client) url(id build.ID) string {
+	return c.endpoint + "/remote/artifact?id=" + url.QueryEscape(id.String())
+}
+
+func readError(rsp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(rsp.Body, 1024))
+	return fmt.Errorf("remote cache: %s: %s", rsp.Status, msg)
+}
+
+// Has проверяет, есть ли результат джоба в удалённом кеше.
+func (c *Client) Has(ctx context.Context, id build.ID) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.url(id), nil)
+	if err != nil {
+		return false, err
+	}
+
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer rsp.Body.Close()
+
+	switch rsp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, readError(rsp)
+	}
+}
+
+// Download скачивает результат джоба в локальный кеш.
+//
+// Если результата нет в удалённом кеше, Download возвращает ошибку, для которой
+// errors.Is(err, artifact.ErrNotFound).
+func (c *Client) Download(ctx context.Context, local *artifact.Cache, id build.ID) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(id), nil)
+	if err != nil {
+		return err
+	}
+
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	switch rsp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return fmt.Errorf("remote cache: %w", artifact.ErrNotFound)
+	default:
+		return readError(rsp)
+	}
+
+	dir, commit, abort, err := local.Create(id)
+	if err != nil {
+		return err
+	}
+
+	if err := tarstream.Receive(dir, rsp.Body); err != nil {
+		_ = abort()
+		return fmt.Errorf("remote cache: receive %s: %w", id, err)
+	}
+
+	c.l.Debug("downloaded artifact from remote cache", zap.String("id", id.String()))
+	return commit()
+}
+
+// writeUpload writes manifest and content of the artifact as two parts of multipart body.
+func writeUpload(mw *multipart.Writer, m *artifact.Manifest, dir string) error {
+	w, err := mw.CreateFormField("manifest")
+	if err != nil {
+		return err
+	}
+	if err = json.NewEncoder(w).Encode(m); err != nil {
+		return err
+	}
+
+	w, err = mw.CreateFormField("artifact")
+	if err != nil {
+		return err
+	}
+	if err = tarstream.Send(dir, w); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// Upload заливает результат джоба из локального кеша в удалённый вместе с его манифестом.
+// Удалённый кеш сверяет полученное дерево с манифестом и отклоняет заливку, если они не совпадают.
+//
+// Если результат уже есть в удалённом кеше, Upload ничего не передаёт.
+func (c *Client) Upload(ctx context.Context, local *artifact.Cache, id build.ID) error {
+	if ok, err := c.Has(ctx, id); err != nil {
+		return err
+	} else if ok {
+		return nil
+	}
+
+	dir, unlock, err := local.Get(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m, err := local.Manifest(id)
+	if errors.Is(err, artifact.ErrNotFound) {
+		// Artifact was committed before manifests were introduced.
+		m, err = artifact.BuildManifest(dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Send must finish before the artifact is unlocked.
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(writeUpload(mw, m, dir))
+	}()
+	defer func() {
+		_ = pr.Close()
+		<-done
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.url(id), pr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return readError(rsp)
+	}
+
+	c.l.Debug("uploaded artifact to remote cache", zap.String("id", id.String()))
+	return nil
+}
@@ -0,0 +1,173 @@
+package remotecache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/tarstream"
+)
+
+// Handler отдаёт и принимает результаты джобов, сохранённые в artifact.Cache.
+type Handler struct {
+	l     *zap.Logger
+	cache *artifact.Cache
+}
+
+func NewHandler(l *zap.Logger, cache *artifact.Cache) *Handler {
+	return &Handler{l: l, cache: cache}
+}
+
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/remote/artifact", h.artifact)
+}
+
+func (h *Handler) artifact(w http.ResponseWriter, r *http.Request) {
+	var id build.ID
+	if err := id.UnmarshalText([]byte(r.URL.Query().Get("id"))); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		h.head(w, id)
+	case http.MethodGet:
+		h.get(w, id)
+	case http.MethodPut:
+		h.put(w, r, id)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) head(w http.ResponseWriter, id build.ID) {
+	_, unlock, err := h.cache.Get(id)
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+	unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) get(w http.ResponseWriter, id build.ID) {
+	if err := h.cache.Verify(id); err != nil && !errors.Is(err, artifact.ErrNotFound) {
+		h.l.Warn("remote cache artifact failed verification", zap.String("id", id.String()), zap.Error(err))
+	}
+
+	dir, unlock, err := h.cache.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	defer unlock()
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	if err := tarstream.Send(dir, w); err != nil {
+		// Заголовок уже отправлен, клиент обнаружит обрыв по неполному tar потоку.
+		h.l.Error("failed to send artifact", zap.String("id", id.String()), zap.Error(err))
+		panic(http.ErrAbortHandler)
+	}
+
+	h.l.Debug("artifact served", zap.String("id", id.String()))
+}
+
+// maxManifestSize ограничивает размер манифеста, который принимает PUT.
+const maxManifestSize = 64 << 20
+
+func readManifest(mr *multipart.Reader) (*artifact.Manifest, error) {
+	part, err := mr.NextPart()
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	defer part.Close()
+
+	if part.FormName() != "manifest" {
+		return nil, fmt.Errorf("expected manifest part, got %q", part.FormName())
+	}
+
+	var m artifact.Manifest
+	if err = json.NewDecoder(io.LimitReader(part, maxManifestSize)).Decode(&m); err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	return &m, nil
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, id build.ID) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("artifact must be uploaded together with its manifest: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	m, err := readManifest(mr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dir, commit, abort, err := h.cache.Create(id)
+	if err != nil {
+		// Артефакт уже есть или его прямо сейчас заливает кто-то другой. Кеш не гарантирует
+		// сохранность, поэтому второй копии не ждём.
+		_, _ = io.Copy(io.Discard, r.Body)
+		if errors.Is(err, artifact.ErrExists) || errors.Is(err, artifact.ErrWriteLocked) {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	part, err := mr.NextPart()
+	if err == nil && part.FormName() != "artifact" {
+		err = fmt.Errorf("expected artifact part, got %q", part.FormName())
+	}
+	if err == nil {
+		err = tarstream.Receive(dir, part)
+	}
+	if err != nil {
+		_ = abort()
+		http.Error(w, fmt.Sprintf("receive artifact: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Received tree must match the manifest, otherwise a truncated or damaged upload
+	// would be served to every other worker.
+	if err = m.Verify(dir); err != nil {
+		_ = abort()
+		h.l.Warn("rejected remote cache upload", zap.String("id", id.String()), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.l.Debug("artifact stored", zap.String("id", id.String()))
+	w.WriteHeader(http.StatusOK)
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, artifact.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, artifact.ErrWriteLocked):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
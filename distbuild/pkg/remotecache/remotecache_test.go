@@ -0,0 +1,216 @@
+package remotecache_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth/authtest"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/remotecache"
+	"gitlab.com/slon/shad-go/distbuild/pkg/tarstream"
+)
+
+func newCache(t *testing.T) *artifact.Cache {
+	c, err := artifact.NewCache(t.TempDir())
+	require.NoError(t, err)
+	return c
+}
+
+func newClient(t *testing.T) (*remotecache.Client, *artifact.Cache) {
+	l := zaptest.NewLogger(t)
+	remote := newCache(t)
+
+	mux := http.NewServeMux()
+	remotecache.NewHandler(l, remote).Register(mux)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return remotecache.NewClient(l, server.URL), remote
+}
+
+func createArtifact(t *testing.T, c *artifact.Cache, id build.ID) {
+	dir, commit, _, err := c.Create(id)
+	require.NoError(t, err)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bin"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bin", "a.out"), []byte("binary"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stdout"), []byte("hello"), 0666))
+	require.NoError(t, commit())
+}
+
+func TestRoundTrip(t *testing.T) {
+	client, _ := newClient(t)
+	ctx := context.Background()
+
+	id := build.ID{0x01}
+	producer := newCache(t)
+	createArtifact(t, producer, id)
+
+	ok, err := client.Has(ctx, id)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, client.Upload(ctx, producer, id))
+	require.NoError(t, client.Upload(ctx, producer, id))
+
+	ok, err = client.Has(ctx, id)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Кеш нового кластера пуст, но результат джоба берётся из удалённого кеша.
+	consumer := newCache(t)
+	require.NoError(t, client.Download(ctx, consumer, id))
+
+	expected, err := producer.Manifest(id)
+	require.NoError(t, err)
+
+	dir, unlock, err := consumer.Get(id)
+	require.NoError(t, err)
+	defer unlock()
+	require.NoError(t, expected.Verify(dir))
+}
+
+func TestDownloadMiss(t *testing.T) {
+	client, _ := newClient(t)
+
+	local := newCache(t)
+	err := client.Download(context.Background(), local, build.ID{0x02})
+	require.Truef(t, errors.Is(err, artifact.ErrNotFound), "%v", err)
+
+	_, _, err = local.Get(build.ID{0x02})
+	require.ErrorIs(t, err, artifact.ErrNotFound)
+}
+
+func TestConcurrentUpload(t *testing.T) {
+	client, remote := newClient(t)
+	ctx := context.Background()
+
+	id := build.ID{0x03}
+
+	const G = 10
+	var workers []*artifact.Cache
+	for i := 0; i < G; i++ {
+		local := newCache(t)
+		createArtifact(t, local, id)
+		workers = append(workers, local)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(G)
+	for _, local := range workers {
+		go func() {
+			defer wg.Done()
+
+			assert.NoError(t, client.Upload(ctx, local, id))
+		}()
+	}
+	wg.Wait()
+
+	require.NoError(t, remote.Verify(id))
+}
+
+func TestUploadCorrupted(t *testing.T) {
+	client, remote := newClient(t)
+	ctx := context.Background()
+
+	id := build.ID{0x04}
+	producer := newCache(t)
+	createArtifact(t, producer, id)
+
+	// Artifact is damaged after commit, so the tree no longer matches the recorded manifest.
+	dir, unlock, err := producer.Get(id)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stdout"), []byte("poisoned"), 0666))
+	unlock()
+
+	require.Error(t, client.Upload(ctx, producer, id))
+
+	_, _, err = remote.Get(id)
+	require.ErrorIs(t, err, artifact.ErrNotFound)
+}
+
+func TestUploadWithoutManifest(t *testing.T) {
+	remote := newCache(t)
+
+	mux := http.NewServeMux()
+	remotecache.NewHandler(zaptest.NewLogger(t), remote).Register(mux)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	id := build.ID{0x05}
+	producer := newCache(t)
+	createArtifact(t, producer, id)
+
+	dir, unlock, err := producer.Get(id)
+	require.NoError(t, err)
+	defer unlock()
+
+	var body bytes.Buffer
+	require.NoError(t, tarstream.Send(dir, &body))
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/remote/artifact?id="+id.String(), &body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-tar")
+
+	rsp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	rsp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+
+	_, _, err = remote.Get(id)
+	require.ErrorIs(t, err, artifact.ErrNotFound)
+}
+
+func TestSecured(t *testing.T) {
+	l := zaptest.NewLogger(t)
+	remote := newCache(t)
+
+	ca, err := authtest.NewCA()
+	require.NoError(t, err)
+	serverCert, err := ca.Issue("cache", "127.0.0.1")
+	require.NoError(t, err)
+	clientCert, err := ca.Issue("worker")
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	remotecache.NewHandler(l, remote).Register(mux)
+
+	server := httptest.NewUnstartedServer(auth.Middleware("secret", mux))
+	server.TLS = auth.ServerTLSConfig(serverCert, ca.Pool())
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	id := build.ID{0x01}
+	createArtifact(t, remote, id)
+
+	tlsConfig := auth.ClientTLSConfig(clientCert, ca.Pool())
+
+	client := remotecache.NewClientWithHTTPClient(l, server.URL, auth.NewHTTPClient(tlsConfig, "secret"))
+	ok, err := client.Has(ctx, id)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	local := newCache(t)
+	require.NoError(t, client.Download(ctx, local, id))
+
+	wrongToken := remotecache.NewClientWithHTTPClient(l, server.URL, auth.NewHTTPClient(tlsConfig, "wrong"))
+	_, err = wrongToken.Has(ctx, id)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "401")
+}
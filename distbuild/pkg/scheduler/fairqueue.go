@@ -0,0 +1,328 @@
+package scheduler
+
+import (
+	"sort"
+	"time"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// FairQueue хранит ожидающие джобы и выдаёт их с учётом приоритета и справедливости между билдами.
+//
+// Джобы с большим приоритетом всегда выдаются раньше. Внутри одного приоритета билды получают
+// джобы по очереди, поэтому большой билд не может занять все воркеры, пока маленький ждёт.
+// Внутри одного билда первыми выдаются джобы с самым длинным JobSpec.CriticalPath, при равенстве -
+// в порядке добавления.
+//
+// FairQueue не concurrency safe, её защищает мьютекс шедулера.
+type FairQueue struct {
+	classes map[int]*fairClass
+	queued  map[*PendingJob]queuedJob
+	seq     uint64
+	size    int
+}
+
+type queuedJob struct {
+	priority int
+	buildID  build.ID
+	seq      uint64
+
+	// skips counts how many times PopWithin returned a job that stood behind this one,
+	// because this job didn't fit into free resources.
+	skips int
+
+	// reservedBy is the worker that stopped taking other jobs until this one fits.
+	reservedBy api.WorkerID
+}
+
+// MaxSkips задаёт, сколько раз PopWithin может выдать джоб в обход более раннего джоба, который
+// подходит воркеру, но не помещается в его свободные ресурсы. После этого ранний джоб резервирует
+// воркер, см. PopWithin.
+const MaxSkips = 8
+
+type fairClass struct {
+	builds map[build.ID]*buildQueue
+
+	// vtime is the minimum number of jobs served to an active build of this class.
+	// Builds that become active start from vtime, so that idle time doesn't turn into credit.
+	vtime uint64
+}
+
+type buildQueue struct {
+	jobs   []*PendingJob
+	served uint64
+}
+
+func NewFairQueue() *FairQueue {
+	return &FairQueue{
+		classes: map[int]*fairClass{},
+		queued:  map[*PendingJob]queuedJob{},
+	}
+}
+
+func (q *FairQueue) Len() int {
+	return q.size
+}
+
+// Push добавляет джоб билда buildID в очередь с приоритетом priority.
+//
+// Повторное добавление джоба, который уже стоит в очереди, может только повысить его приоритет.
+func (q *FairQueue) Push(job *PendingJob, buildID build.ID, priority int) {
+	if old, ok := q.queued[job]; ok {
+		if old.priority >= priority {
+			return
+		}
+		q.Remove(job)
+	}
+
+	class, ok := q.classes[priority]
+	if !ok {
+		class = &fairClass{builds: map[build.ID]*buildQueue{}}
+		q.classes[priority] = class
+	}
+
+	bq, ok := class.builds[buildID]
+	if !ok {
+		bq = &buildQueue{}
+		class.builds[buildID] = bq
+	}
+	if len(bq.jobs) == 0 && bq.served < class.vtime {
+		bq.served = class.vtime
+	}
+
+	// Jobs of a build are kept sorted by critical path, insertion keeps FIFO order among equals.
+	i := len(bq.jobs)
+	for i > 0 && criticalPath(bq.jobs[i-1]) < criticalPath(job) {
+		i--
+	}
+	bq.jobs = append(bq.jobs, nil)
+	copy(bq.jobs[i+1:], bq.jobs[i:])
+	bq.jobs[i] = job
+
+	q.seq++
+	q.queued[job] = queuedJob{priority: priority, buildID: buildID, seq: q.seq}
+	q.size++
+}
+
+func cost(job *PendingJob) build.Resources {
+	if job.Job == nil {
+		return build.DefaultResources
+	}
+	return job.Job.Cost()
+}
+
+func criticalPath(job *PendingJob) time.Duration {
+	if job.Job == nil {
+		return 0
+	}
+	return job.Job.CriticalPath
+}
+
+// Top возвращает приоритет джоба, который вернёт следующий вызов Pop.
+func (q *FairQueue) Top() (priority int, ok bool) {
+	return q.TopMatching(nil)
+}
+
+// TopMatching возвращает приоритет джоба, который вернёт следующий вызов PopMatching(accept).
+func (q *FairQueue) TopMatching(accept func(job *PendingJob) bool) (priority int, ok bool) {
+	priority, _, _, ok = q.find(acceptOnly(accept))
+	return
+}
+
+// Pop извлекает следующий джоб или возвращает nil, если очередь пуста.
+func (q *FairQueue) Pop() *PendingJob {
+	return q.PopMatching(nil)
+}
+
+// PopMatching извлекает следующий джоб, для которого accept возвращает true.
+//
+// Неподходящие джобы пропускаются и остаются в очереди. Nil accept принимает любой джоб.
+func (q *FairQueue) PopMatching(accept func(job *PendingJob) bool) *PendingJob {
+	priority, next, i, ok := q.find(acceptOnly(accept))
+	if !ok {
+		return nil
+	}
+	return q.pop(priority, next, i)
+}
+
+// TopWithin возвращает приоритет джоба, который вернёт следующий вызов PopWithin(workerID, match, free).
+//
+// Если перед первым подходящим джобом стоит джоб, зарезервированный воркером workerID или
+// который PopWithin зарезервирует, TopWithin возвращает reserved == true и приоритет этого джоба.
+func (q *FairQueue) TopWithin(workerID api.WorkerID, match func(job *PendingJob) bool, free build.Resources) (priority int, ok, reserved bool) {
+	var blocked *PendingJob
+	priority, _, _, ok = q.find(q.within(workerID, match, free, nil, &blocked))
+	if blocked != nil {
+		return q.queued[blocked].priority, false, true
+	}
+	return priority, ok, false
+}
+
+// PopWithin извлекает для воркера workerID следующий джоб, для которого match возвращает true
+// и который помещается в свободные ресурсы free (см. build.Job.Cost).
+//
+// match должен проверять, что джоб в принципе может выполниться на воркере: подходит по требованиям
+// и помещается в полные ресурсы воркера. Джобы, которые подходят, но не помещаются в free, пропускаются
+// и остаются в очереди.
+//
+// Чтобы тяжёлый джоб не ждал вечно, пока лёгкие занимают освободившиеся ресурсы, после MaxSkips пропусков
+// первый воркер, которому он не поместился, резервирует его: PopWithin этого воркера возвращает nil,
+// пока ресурсы воркера не освободятся настолько, что джоб поместится. Остальные воркеры пропускают
+// зарезервированный джоб и продолжают получать джобы, которые в них помещаются.
+func (q *FairQueue) PopWithin(workerID api.WorkerID, match func(job *PendingJob) bool, free build.Resources) *PendingJob {
+	var skipped []*PendingJob
+	var blocked *PendingJob
+	priority, next, i, ok := q.find(q.within(workerID, match, free, &skipped, &blocked))
+	if blocked != nil {
+		info := q.queued[blocked]
+		info.reservedBy = workerID
+		q.queued[blocked] = info
+		return nil
+	} else if !ok {
+		return nil
+	}
+
+	for _, job := range skipped {
+		info := q.queued[job]
+		info.skips++
+		q.queued[job] = info
+	}
+	return q.pop(priority, next, i)
+}
+
+// Unreserve снимает резервы воркера workerID. Шедулер вызывает его для потерянного воркера.
+func (q *FairQueue) Unreserve(workerID api.WorkerID) {
+	for job, info := range q.queued {
+		if info.reservedBy == workerID {
+			info.reservedBy = ""
+			q.queued[job] = info
+		}
+	}
+}
+
+// within returns visitor for find that implements reservation of PopWithin.
+func (q *FairQueue) within(workerID api.WorkerID, match func(job *PendingJob) bool, free build.Resources, skipped *[]*PendingJob, blocked **PendingJob) visitor {
+	return func(job *PendingJob) (accept, stop bool) {
+		if match != nil && !match(job) {
+			return false, false
+		}
+		if cost(job).Fits(free) {
+			return true, false
+		}
+
+		info := q.queued[job]
+		switch {
+		case info.reservedBy == workerID:
+			*blocked = job
+			return false, true
+		case info.reservedBy != "":
+			// Another worker waits for this job.
+			return false, false
+		case info.skips >= MaxSkips:
+			*blocked = job
+			return false, true
+		default:
+			if skipped != nil {
+				*skipped = append(*skipped, job)
+			}
+			return false, false
+		}
+	}
+}
+
+func (q *FairQueue) pop(priority int, next *buildQueue, i int) *PendingJob {
+	class := q.classes[priority]
+
+	job := next.jobs[i]
+	next.served++
+	q.remove(job)
+
+	first := true
+	for _, bq := range class.builds {
+		if first || bq.served < class.vtime {
+			class.vtime = bq.served
+			first = false
+		}
+	}
+
+	return job
+}
+
+// visitor decides whether find returns the job, or stops the search without result.
+type visitor func(job *PendingJob) (accept, stop bool)
+
+func acceptOnly(accept func(job *PendingJob) bool) visitor {
+	return func(job *PendingJob) (bool, bool) {
+		return accept == nil || accept(job), false
+	}
+}
+
+// find returns the queue and the position of the next accepted job.
+func (q *FairQueue) find(visit visitor) (priority int, next *buildQueue, index int, ok bool) {
+	priorities := make([]int, 0, len(q.classes))
+	for p := range q.classes {
+		priorities = append(priorities, p)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(priorities)))
+
+	for _, p := range priorities {
+		builds := make([]*buildQueue, 0, len(q.classes[p].builds))
+		for _, bq := range q.classes[p].builds {
+			builds = append(builds, bq)
+		}
+
+		// Least served build goes first, ties are broken by the age of the head job.
+		sort.Slice(builds, func(i, j int) bool {
+			if builds[i].served != builds[j].served {
+				return builds[i].served < builds[j].served
+			}
+			return q.queued[builds[i].jobs[0]].seq < q.queued[builds[j].jobs[0]].seq
+		})
+
+		for _, bq := range builds {
+			for i, job := range bq.jobs {
+				accept, stop := visit(job)
+				switch {
+				case stop:
+					return 0, nil, 0, false
+				case accept:
+					return p, bq, i, true
+				}
+			}
+		}
+	}
+
+	return 0, nil, 0, false
+}
+
+// Remove удаляет джоб из очереди. Удаление отсутствующего джоба ничего не делает.
+func (q *FairQueue) Remove(job *PendingJob) {
+	if _, ok := q.queued[job]; ok {
+		q.remove(job)
+	}
+}
+
+func (q *FairQueue) remove(job *PendingJob) {
+	info := q.queued[job]
+	delete(q.queued, job)
+	q.size--
+
+	class := q.classes[info.priority]
+	bq := class.builds[info.buildID]
+	for i, j := range bq.jobs {
+		if j == job {
+			bq.jobs = append(bq.jobs[:i], bq.jobs[i+1:]...)
+			break
+		}
+	}
+
+	// Build that runs out of jobs forgets its served counter. When it comes back, it starts
+	// from vtime of the class.
+	if len(bq.jobs) == 0 {
+		delete(class.builds, info.buildID)
+	}
+	if len(class.builds) == 0 {
+		delete(q.classes, info.priority)
+	}
+}
@@ -0,0 +1,226 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+)
+
+var jobCounter byte
+
+func newJobs(n int) []*scheduler.PendingJob {
+	var jobs []*scheduler.PendingJob
+	for i := 0; i < n; i++ {
+		jobCounter++
+		jobs = append(jobs, &scheduler.PendingJob{Job: &api.JobSpec{Job: build.Job{ID: build.ID{jobCounter}}}})
+	}
+	return jobs
+}
+
+func popAll(q *scheduler.FairQueue) []*scheduler.PendingJob {
+	var jobs []*scheduler.PendingJob
+	for q.Len() != 0 {
+		jobs = append(jobs, q.Pop())
+	}
+	return jobs
+}
+
+func TestFairQueueFairShare(t *testing.T) {
+	q := scheduler.NewFairQueue()
+	huge, small := build.ID{'h'}, build.ID{'s'}
+
+	a := newJobs(4)
+	for _, job := range a {
+		q.Push(job, huge, 0)
+	}
+
+	require.Equal(t, a[0], q.Pop())
+
+	b := newJobs(2)
+	for _, job := range b {
+		q.Push(job, small, 0)
+	}
+
+	// Small build joins on par with the huge one, without a credit for the time it was idle.
+	// On ties the older job goes first.
+	require.Equal(t, []*scheduler.PendingJob{a[1], b[0], a[2], b[1], a[3]}, popAll(q))
+	require.Nil(t, q.Pop())
+}
+
+func TestFairQueuePriority(t *testing.T) {
+	q := scheduler.NewFairQueue()
+
+	low, high := newJobs(2), newJobs(1)
+	q.Push(low[0], build.ID{'l'}, 0)
+	q.Push(low[1], build.ID{'l'}, 0)
+	q.Push(high[0], build.ID{'h'}, 10)
+
+	priority, ok := q.Top()
+	require.True(t, ok)
+	require.Equal(t, 10, priority)
+
+	// Shared job is raised to the priority of the more important build.
+	q.Push(low[1], build.ID{'h'}, 10)
+	q.Push(low[1], build.ID{'l'}, 0)
+
+	require.Equal(t, []*scheduler.PendingJob{high[0], low[1], low[0]}, popAll(q))
+
+	_, ok = q.Top()
+	require.False(t, ok)
+}
+
+func TestFairQueueRemove(t *testing.T) {
+	q := scheduler.NewFairQueue()
+
+	jobs := newJobs(3)
+	for _, job := range jobs {
+		q.Push(job, build.ID{'a'}, 0)
+	}
+
+	q.Remove(jobs[1])
+	q.Remove(jobs[1])
+	require.Equal(t, 2, q.Len())
+	require.Equal(t, []*scheduler.PendingJob{jobs[0], jobs[2]}, popAll(q))
+}
+
+func TestFairQueueCriticalPath(t *testing.T) {
+	q := scheduler.NewFairQueue()
+
+	jobs := newJobs(4)
+	jobs[0].Job.CriticalPath = time.Second
+	jobs[1].Job.CriticalPath = 10 * time.Second
+	jobs[2].Job.CriticalPath = time.Second
+	jobs[3].Job.CriticalPath = 5 * time.Second
+
+	for _, job := range jobs {
+		q.Push(job, build.ID{'a'}, 0)
+	}
+
+	require.Equal(t, []*scheduler.PendingJob{jobs[1], jobs[3], jobs[0], jobs[2]}, popAll(q))
+}
+
+func TestFairQueuePopMatching(t *testing.T) {
+	q := scheduler.NewFairQueue()
+
+	jobs := newJobs(3)
+	jobs[0].Job.Resources = &build.Resources{CPU: 4}
+	jobs[1].Job.Resources = &build.Resources{CPU: 4}
+	jobs[2].Job.Resources = &build.Resources{CPU: 1}
+
+	q.Push(jobs[0], build.ID{'a'}, 0)
+	q.Push(jobs[1], build.ID{'a'}, 0)
+	q.Push(jobs[2], build.ID{'b'}, 1)
+
+	free := build.Resources{CPU: 6}
+	fits := func(job *scheduler.PendingJob) bool {
+		return job.Job.Cost().Fits(free)
+	}
+
+	var picked []*scheduler.PendingJob
+	for {
+		job := q.PopMatching(fits)
+		if job == nil {
+			break
+		}
+
+		free = free.Sub(job.Job.Cost())
+		picked = append(picked, job)
+	}
+
+	// Second heavy job doesn't fit and stays in the queue.
+	require.Equal(t, []*scheduler.PendingJob{jobs[2], jobs[0]}, picked)
+	require.Equal(t, 1, q.Len())
+
+	_, ok := q.TopMatching(fits)
+	require.False(t, ok)
+	require.Equal(t, jobs[1], q.Pop())
+}
+
+func TestFairQueuePopWithinReservation(t *testing.T) {
+	q := scheduler.NewFairQueue()
+
+	heavy := newJobs(1)[0]
+	heavy.Job.Resources = &build.Resources{CPU: 4}
+	q.Push(heavy, build.ID{'a'}, 0)
+
+	light := newJobs(scheduler.MaxSkips + 1)
+	for _, job := range light {
+		q.Push(job, build.ID{'a'}, 0)
+	}
+
+	// Heavy job never fits, while light jobs keep the worker busy.
+	free := build.Resources{CPU: 2}
+	for _, job := range light[:scheduler.MaxSkips] {
+		require.Equal(t, job, q.PopWithin("w0", nil, free))
+	}
+
+	// Heavy job reserved the worker, light jobs wait until it fits.
+	_, ok, reserved := q.TopWithin("w0", nil, free)
+	require.False(t, ok)
+	require.True(t, reserved)
+	require.Nil(t, q.PopWithin("w0", nil, free))
+
+	free = build.Resources{CPU: 4}
+	require.Equal(t, heavy, q.PopWithin("w0", nil, free))
+	require.Equal(t, light[scheduler.MaxSkips], q.PopWithin("w0", nil, free))
+}
+
+func TestFairQueuePopWithinMatch(t *testing.T) {
+	q := scheduler.NewFairQueue()
+
+	heavy := newJobs(1)[0]
+	heavy.Job.Resources = &build.Resources{CPU: 16}
+	q.Push(heavy, build.ID{'a'}, 0)
+
+	light := newJobs(scheduler.MaxSkips + 1)
+	for _, job := range light {
+		q.Push(job, build.ID{'a'}, 0)
+	}
+
+	// Job that can never run on the worker doesn't reserve it.
+	small := func(job *scheduler.PendingJob) bool {
+		return job.Job.Cost().CPU <= 4
+	}
+
+	free := build.Resources{CPU: 4}
+	for _, job := range light {
+		require.Equal(t, job, q.PopWithin("w0", small, free))
+	}
+	require.Nil(t, q.PopWithin("w0", small, free))
+	require.Equal(t, heavy, q.Pop())
+}
+
+func TestFairQueuePopWithinReservedByOneWorker(t *testing.T) {
+	q := scheduler.NewFairQueue()
+
+	heavy := newJobs(1)[0]
+	heavy.Job.Resources = &build.Resources{CPU: 4}
+	q.Push(heavy, build.ID{'a'}, 0)
+
+	light := newJobs(scheduler.MaxSkips + 2)
+	for _, job := range light {
+		q.Push(job, build.ID{'a'}, 0)
+	}
+
+	free := build.Resources{CPU: 2}
+	for _, job := range light[:scheduler.MaxSkips] {
+		require.Equal(t, job, q.PopWithin("w0", nil, free))
+	}
+
+	// w0 reserves the heavy job, w1 keeps taking light jobs.
+	require.Nil(t, q.PopWithin("w0", nil, free))
+	require.Equal(t, light[scheduler.MaxSkips], q.PopWithin("w1", nil, free))
+
+	_, _, reserved := q.TopWithin("w1", nil, free)
+	require.False(t, reserved)
+
+	// Reservation of the lost worker is moved to the next worker that can't fit the job.
+	q.Unreserve("w0")
+	require.Nil(t, q.PopWithin("w1", nil, free))
+	require.Equal(t, light[scheduler.MaxSkips+1], q.PopWithin("w0", nil, free))
+}
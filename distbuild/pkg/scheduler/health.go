@@ -0,0 +1,224 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// DefaultHeartbeatTimeout используется, если HealthConfig.HeartbeatTimeout не задан.
+const DefaultHeartbeatTimeout = 30 * time.Second
+
+// HealthConfig задаёт параметры WorkerHealth.
+type HealthConfig struct {
+	// HeartbeatTimeout задаёт, через сколько времени без heartbeat-ов воркер считается потерянным.
+	// Ноль означает DefaultHeartbeatTimeout.
+	HeartbeatTimeout time.Duration
+
+	// MaxFailures задаёт число инфраструктурных ошибок подряд, после которого воркер
+	// отправляется в карантин. Ноль отключает карантин.
+	MaxFailures int
+
+	// QuarantineTimeout задаёт, сколько времени воркер проводит в карантине.
+	QuarantineTimeout time.Duration
+}
+
+// WorkerHealth следит за тем, какие воркеры живы и каким можно выдавать джобы.
+//
+// Текущее время передаётся в методы явно. Все методы WorkerHealth concurrency safe.
+type WorkerHealth struct {
+	config HealthConfig
+
+	mu      sync.Mutex
+	workers map[api.WorkerID]*workerHealth
+}
+
+type workerHealth struct {
+	labels map[string]string
+
+	// total are resources of the worker, zero fields are unknown.
+	total build.Resources
+
+	lastHeartbeat    time.Time
+	lost             bool
+	failures         int
+	quarantinedUntil time.Time
+}
+
+func NewWorkerHealth(config HealthConfig) *WorkerHealth {
+	if config.HeartbeatTimeout <= 0 {
+		config.HeartbeatTimeout = DefaultHeartbeatTimeout
+	}
+
+	return &WorkerHealth{
+		config:  config,
+		workers: map[api.WorkerID]*workerHealth{},
+	}
+}
+
+func (h *WorkerHealth) worker(workerID api.WorkerID) *workerHealth {
+	w, ok := h.workers[workerID]
+	if !ok {
+		w = &workerHealth{}
+		h.workers[workerID] = w
+	}
+	return w
+}
+
+// Heartbeat отмечает, что воркер прислал heartbeat.
+//
+// Воркер, который ранее был признан потерянным, снова считается живым, но джобы,
+// которые он выполнял, к этому моменту уже перезапущены.
+func (h *WorkerHealth) Heartbeat(workerID api.WorkerID, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	w := h.worker(workerID)
+	w.lastHeartbeat = now
+	w.lost = false
+}
+
+// SetCapabilities запоминает метки и полные ресурсы воркера. Нулевые поля total означают,
+// что воркер их не сообщил.
+func (h *WorkerHealth) SetCapabilities(workerID api.WorkerID, labels map[string]string, total build.Resources) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	w := h.worker(workerID)
+	w.labels = labels
+	w.total = total
+}
+
+// FindWorker проверяет, что среди живых воркеров есть хотя бы один, подходящий под требования джоба
+// и способный вместить его по памяти и процессору.
+//
+// Воркеры в карантине считаются подходящими, поскольку они вернутся после окончания карантина.
+// Если подходящего воркера нет, FindWorker возвращает ошибку с требованиями джоба, и координатор
+// может сразу завершить билд с BuildFailed.
+//
+// Если живых воркеров нет совсем, FindWorker возвращает nil: воркеры могли ещё не подключиться,
+// и джоб должен дождаться их в очереди.
+func (h *WorkerHealth) FindWorker(job *build.Job) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ids := make([]api.WorkerID, 0, len(h.workers))
+	for id := range h.workers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var live int
+	var lastErr error
+	for _, id := range ids {
+		w := h.workers[id]
+		if w.lost {
+			continue
+		}
+		live++
+
+		cost := job.Cost()
+		lastErr = job.Requirements.Match(w.labels, w.total.Memory)
+		switch {
+		case lastErr != nil:
+		case w.total.Memory != 0 && cost.Memory > w.total.Memory:
+			lastErr = fmt.Errorf("%w: job needs %d bytes of memory", build.ErrUnsatisfied, cost.Memory)
+		case w.total.CPU != 0 && cost.CPU > w.total.CPU:
+			lastErr = fmt.Errorf("%w: job needs %d cpu slots", build.ErrUnsatisfied, cost.CPU)
+		}
+
+		if lastErr == nil {
+			return nil
+		}
+	}
+
+	if live == 0 {
+		// Workers may not have connected yet, nothing to check against.
+		return nil
+	}
+	return fmt.Errorf("job %q: no worker satisfies requirements: %w", job.Name, lastErr)
+}
+
+// Lost возвращает воркеры, от которых дольше HeartbeatTimeout не было heartbeat-ов.
+//
+// Каждый потерянный воркер возвращается один раз. Координатор должен перезапустить
+// все джобы, которые выполнялись на этих воркерах.
+func (h *WorkerHealth) Lost(now time.Time) []api.WorkerID {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var lost []api.WorkerID
+	for id, w := range h.workers {
+		if !w.lost && now.Sub(w.lastHeartbeat) > h.config.HeartbeatTimeout {
+			w.lost = true
+			lost = append(lost, id)
+		}
+	}
+
+	sort.Slice(lost, func(i, j int) bool { return lost[i] < lost[j] })
+	return lost
+}
+
+// OnJobSuccess сбрасывает счётчик ошибок воркера.
+func (h *WorkerHealth) OnJobSuccess(workerID api.WorkerID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.worker(workerID).failures = 0
+}
+
+// OnInfraError учитывает инфраструктурную ошибку воркера и сообщает, попал ли воркер в карантин.
+//
+// Ненулевой ExitCode джоба инфраструктурной ошибкой не является.
+func (h *WorkerHealth) OnInfraError(workerID api.WorkerID, now time.Time) (quarantined bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	w := h.worker(workerID)
+	w.failures++
+
+	if h.config.MaxFailures != 0 && w.failures >= h.config.MaxFailures {
+		w.failures = 0
+		w.quarantinedUntil = now.Add(h.config.QuarantineTimeout)
+		return true
+	}
+	return false
+}
+
+// Available сообщает, можно ли выдавать воркеру новые джобы.
+func (h *WorkerHealth) Available(workerID api.WorkerID, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	w, ok := h.workers[workerID]
+	if !ok {
+		return true
+	}
+	return !w.lost && !now.Before(w.quarantinedUntil)
+}
+
+// Status возвращает состояние всех известных воркеров, упорядоченных по ID.
+//
+// Поля, которые приходят в heartbeat-е, заполняет координатор.
+func (h *WorkerHealth) Status(now time.Time) []api.WorkerStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := make([]api.WorkerStatus, 0, len(h.workers))
+	for id, w := range h.workers {
+		status = append(status, api.WorkerStatus{
+			ID:            id,
+			Labels:        w.labels,
+			LastHeartbeat: w.lastHeartbeat,
+			Lost:          w.lost,
+			Quarantined:   now.Before(w.quarantinedUntil),
+		})
+	}
+
+	sort.Slice(status, func(i, j int) bool { return status[i].ID < status[j].ID })
+	return status
+}
@@ -0,0 +1,130 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+)
+
+var healthConfig = scheduler.HealthConfig{
+	HeartbeatTimeout:  time.Second,
+	MaxFailures:       2,
+	QuarantineTimeout: time.Minute,
+}
+
+func TestWorkerHealthLost(t *testing.T) {
+	h := scheduler.NewWorkerHealth(healthConfig)
+	start := time.Now()
+
+	h.Heartbeat("w0", start)
+	h.Heartbeat("w1", start)
+
+	require.Empty(t, h.Lost(start.Add(time.Second/2)))
+
+	h.Heartbeat("w1", start.Add(time.Second))
+	require.Equal(t, []api.WorkerID{"w0"}, h.Lost(start.Add(2*time.Second)))
+	require.Empty(t, h.Lost(start.Add(2*time.Second)), "lost worker is reported once")
+	require.False(t, h.Available("w0", start.Add(2*time.Second)))
+
+	h.Heartbeat("w0", start.Add(3*time.Second))
+	require.True(t, h.Available("w0", start.Add(3*time.Second)))
+}
+
+func TestWorkerHealthDefaultTimeout(t *testing.T) {
+	h := scheduler.NewWorkerHealth(scheduler.HealthConfig{})
+	start := time.Now()
+
+	h.Heartbeat("w0", start)
+	require.Empty(t, h.Lost(start.Add(time.Second)))
+	require.Equal(t, []api.WorkerID{"w0"}, h.Lost(start.Add(scheduler.DefaultHeartbeatTimeout+time.Second)))
+}
+
+func TestWorkerHealthQuarantine(t *testing.T) {
+	h := scheduler.NewWorkerHealth(healthConfig)
+	now := time.Now()
+	h.Heartbeat("w0", now)
+
+	require.False(t, h.OnInfraError("w0", now))
+	h.OnJobSuccess("w0")
+	require.False(t, h.OnInfraError("w0", now))
+	require.True(t, h.Available("w0", now))
+
+	require.True(t, h.OnInfraError("w0", now))
+	require.False(t, h.Available("w0", now))
+
+	h.Heartbeat("w0", now.Add(healthConfig.QuarantineTimeout))
+	require.True(t, h.Available("w0", now.Add(healthConfig.QuarantineTimeout)))
+}
+
+func TestWorkerHealthFindWorker(t *testing.T) {
+	h := scheduler.NewWorkerHealth(healthConfig)
+	now := time.Now()
+
+	job := &build.Job{
+		Name:         "test",
+		Requirements: &build.Requirements{Labels: map[string]string{"os": "darwin"}},
+	}
+	require.NoError(t, h.FindWorker(job), "no workers connected yet")
+
+	h.Heartbeat("w0", now)
+	h.SetCapabilities("w0", map[string]string{"os": "linux"}, build.Resources{Memory: 1 << 30})
+
+	err := h.FindWorker(job)
+	require.ErrorIs(t, err, build.ErrUnsatisfied)
+	require.Contains(t, err.Error(), "os=darwin")
+
+	require.NoError(t, h.FindWorker(&build.Job{Name: "any"}))
+
+	h.Heartbeat("w1", now)
+	h.SetCapabilities("w1", map[string]string{"os": "darwin"}, build.Resources{Memory: 1 << 30})
+	require.NoError(t, h.FindWorker(job))
+
+	require.Equal(t, []api.WorkerID{"w0", "w1"}, h.Lost(now.Add(time.Minute)))
+	require.NoError(t, h.FindWorker(job), "all workers are lost")
+}
+
+func TestWorkerHealthFindWorkerMemory(t *testing.T) {
+	h := scheduler.NewWorkerHealth(healthConfig)
+
+	h.Heartbeat("w0", time.Now())
+	h.SetCapabilities("w0", nil, build.Resources{Memory: 4 << 30})
+
+	require.NoError(t, h.FindWorker(&build.Job{Resources: &build.Resources{CPU: 1, Memory: 2 << 30}}))
+	require.ErrorIs(t, h.FindWorker(&build.Job{Resources: &build.Resources{CPU: 1, Memory: 8 << 30}}), build.ErrUnsatisfied)
+}
+
+func TestWorkerHealthFindWorkerCPU(t *testing.T) {
+	h := scheduler.NewWorkerHealth(healthConfig)
+
+	h.Heartbeat("w0", time.Now())
+	h.SetCapabilities("w0", nil, build.Resources{CPU: 4})
+
+	require.NoError(t, h.FindWorker(&build.Job{Resources: &build.Resources{CPU: 4}}))
+	require.ErrorIs(t, h.FindWorker(&build.Job{Resources: &build.Resources{CPU: 8}}), build.ErrUnsatisfied)
+}
+
+func TestWorkerHealthStatus(t *testing.T) {
+	h := scheduler.NewWorkerHealth(healthConfig)
+	start := time.Now()
+
+	h.Heartbeat("w1", start)
+	h.Heartbeat("w0", start)
+	h.SetCapabilities("w0", map[string]string{"os": "linux"}, build.Resources{})
+
+	h.OnInfraError("w1", start)
+	h.OnInfraError("w1", start)
+
+	now := start.Add(2 * time.Second)
+	h.Heartbeat("w1", now)
+	h.Lost(now)
+
+	require.Equal(t, []api.WorkerStatus{
+		{ID: "w0", Labels: map[string]string{"os": "linux"}, LastHeartbeat: start, Lost: true},
+		{ID: "w1", LastHeartbeat: now, Quarantined: true},
+	}, h.Status(now))
+}
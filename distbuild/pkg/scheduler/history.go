@@ -0,0 +1,58 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// historyWeight is the weight of the latest observation in the moving average.
+const historyWeight = 0.3
+
+// DurationHistory запоминает, сколько времени выполнялись джобы с данным именем.
+//
+// Для оценки используется экспоненциальное скользящее среднее, поэтому оценка быстро
+// подстраивается под изменения, но не прыгает от единичных выбросов.
+//
+// Все методы DurationHistory concurrency safe.
+type DurationHistory struct {
+	defaultDuration time.Duration
+
+	mu        sync.Mutex
+	durations map[string]time.Duration
+}
+
+// NewDurationHistory создаёт историю. defaultDuration задаёт оценку для джобов,
+// которые ещё ни разу не выполнялись.
+func NewDurationHistory(defaultDuration time.Duration) *DurationHistory {
+	return &DurationHistory{
+		defaultDuration: defaultDuration,
+		durations:       map[string]time.Duration{},
+	}
+}
+
+// Observe записывает время выполнения джоба.
+func (h *DurationHistory) Observe(name string, d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	prev, ok := h.durations[name]
+	if !ok {
+		h.durations[name] = d
+		return
+	}
+
+	h.durations[name] = time.Duration(historyWeight*float64(d) + (1-historyWeight)*float64(prev))
+}
+
+// Estimate возвращает ожидаемое время выполнения джоба.
+func (h *DurationHistory) Estimate(job *build.Job) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if d, ok := h.durations[job.Name]; ok {
+		return d
+	}
+	return h.defaultDuration
+}
@@ -0,0 +1,29 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+)
+
+func TestDurationHistory(t *testing.T) {
+	h := scheduler.NewDurationHistory(time.Second)
+
+	link := &build.Job{Name: "link"}
+	require.Equal(t, time.Second, h.Estimate(link))
+
+	h.Observe("link", 10*time.Second)
+	require.Equal(t, 10*time.Second, h.Estimate(link))
+
+	h.Observe("link", 20*time.Second)
+	require.Equal(t, 13*time.Second, h.Estimate(link))
+
+	require.Equal(t, time.Second, h.Estimate(&build.Job{Name: "vet"}))
+
+	remaining := build.CriticalPath([]build.Job{*link}, h.Estimate)
+	require.Equal(t, 13*time.Second, remaining[link.ID])
+}
@@ -23,6 +23,10 @@ type PendingJob struct {
 type Config struct {
 	CacheTimeout time.Duration
 	DepsTimeout  time.Duration
+
+	// MaxRetries задаёт, сколько раз джоб перезапускается после инфраструктурной ошибки
+	// или потери воркера.
+	MaxRetries int
 }
 
 type Scheduler struct {
@@ -32,6 +36,21 @@ func NewScheduler(l *zap.Logger, config Config) *Scheduler {
 	panic("implement me")
 }
 
+// RegisterWorker сообщает шедулеру о новом воркере. Координатор вызывает этот метод
+// при получении первого heartbeat-а от воркера.
+func (c *Scheduler) RegisterWorker(workerID api.WorkerID) {
+	panic("implement me")
+}
+
+// UpdateWorker запоминает метки и полные ресурсы воркера из HeartbeatRequest.Labels,
+// HeartbeatRequest.Memory и HeartbeatRequest.CPU.
+//
+// PickJob выдаёт воркеру только те джобы, чьи build.Requirements ему подходят. PickJobWithin
+// не резервирует воркер под джоб, который не помещается в его полные ресурсы.
+func (c *Scheduler) UpdateWorker(workerID api.WorkerID, labels map[string]string, total build.Resources) {
+	panic("implement me")
+}
+
 func (c *Scheduler) LocateArtifact(id build.ID) (api.WorkerID, bool) {
 	panic("implement me")
 }
@@ -40,10 +59,41 @@ func (c *Scheduler) OnJobComplete(workerID api.WorkerID, jobID build.ID, res *ap
 	panic("implement me")
 }
 
+// OnArtifactEvicted сообщает, что воркер удалил артефакт из своего кеша. Координатор вызывает
+// этот метод для каждого ID из HeartbeatRequest.EvictedArtifacts.
+//
+// После вызова LocateArtifact больше не возвращает этот воркер для artifactID, а джобы, зависящие
+// от artifactID, не попадают в локальную очередь воркера.
+func (c *Scheduler) OnArtifactEvicted(workerID api.WorkerID, artifactID build.ID) {
+	panic("implement me")
+}
+
+// OnWorkerLost сообщает, что воркер перестал присылать heartbeat-ы.
+//
+// Все джобы, выданные этому воркеру и ещё не завершённые, возвращаются в глобальную очередь,
+// если у них не исчерпан бюджет перезапусков.
+func (c *Scheduler) OnWorkerLost(workerID api.WorkerID) {
+	panic("implement me")
+}
+
 func (c *Scheduler) ScheduleJob(job *api.JobSpec) *PendingJob {
 	panic("implement me")
 }
 
+// CancelJob сообщает, что джоб больше не нужен одному из билдов, которые его запланировали.
+//
+// Когда джоб не нужен ни одному билду, он удаляется из очередей. Если при этом джоб уже выполняется,
+// CancelJob возвращает воркер, которому нужно передать отмену в HeartbeatResponse.JobsToCancel.
+func (c *Scheduler) CancelJob(jobID build.ID) (workerID api.WorkerID, running bool) {
+	panic("implement me")
+}
+
+// PickJobWithin работает как PickJob, но выдаёт только джоб, который помещается в свободные
+// ресурсы воркера free (см. build.Job.Cost).
+func (c *Scheduler) PickJobWithin(ctx context.Context, workerID api.WorkerID, free build.Resources) *PendingJob {
+	panic("implement me")
+}
+
 func (c *Scheduler) PickJob(ctx context.Context, workerID api.WorkerID) *PendingJob {
 	panic("implement me")
 }
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package tarstream
+
+import "os"
+
+type fileKey struct{}
+
+// hardlinkKey is not implemented on this platform, so hardlinks are sent as separate files.
+func hardlinkKey(info os.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
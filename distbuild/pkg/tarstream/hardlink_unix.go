@@ -0,0 +1,21 @@
+//go:build unix
+
+package tarstream
+
+import (
+	"os"
+	"syscall"
+)
+
+type fileKey struct {
+	dev, ino uint64
+}
+
+func hardlinkKey(info os.FileInfo) (fileKey, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return fileKey{}, false
+	}
+
+	return fileKey{dev: uint64(st.Dev), ino: st.Ino}, true
+}
@@ -2,14 +2,32 @@ package tarstream
 
 import (
 	"archive/tar"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
+// UnsafePathError сообщает, что запись в потоке указывает за пределы директории, в которую
+// происходит распаковка.
+type UnsafePathError struct {
+	Name string
+}
+
+func (e *UnsafePathError) Error() string {
+	return fmt.Sprintf("tarstream: path %q escapes target directory", e.Name)
+}
+
 // Send рекурсивно обходит директорию и сериализует её содержимое в поток w.
+//
+// Символические ссылки передаются как ссылки, файлы с несколькими жёсткими ссылками
+// передаются один раз. Права доступа и время модификации сохраняются.
 func Send(dir string, w io.Writer) error {
 	tw := tar.NewWriter(w)
+	links := map[fileKey]string{}
 
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -25,21 +43,38 @@ func Send(dir string, w io.Writer) error {
 			return nil
 		}
 
+		h := &tar.Header{
+			Name:    filepath.ToSlash(rel),
+			Mode:    int64(info.Mode().Perm()),
+			ModTime: info.ModTime(),
+			Format:  tar.FormatPAX,
+		}
+
 		switch {
 		case info.IsDir():
-			return tw.WriteHeader(&tar.Header{
-				Name:     rel,
-				Typeflag: tar.TypeDir,
-			})
+			h.Typeflag = tar.TypeDir
+			return tw.WriteHeader(h)
 
-		default:
-			h := &tar.Header{
-				Typeflag: tar.TypeReg,
-				Name:     rel,
-				Size:     info.Size(),
-				Mode:     int64(info.Mode()),
+		case info.Mode()&fs.ModeSymlink != 0:
+			h.Typeflag = tar.TypeSymlink
+			if h.Linkname, err = os.Readlink(path); err != nil {
+				return err
+			}
+			return tw.WriteHeader(h)
+
+		case info.Mode().IsRegular():
+			if key, ok := hardlinkKey(info); ok {
+				if target, ok := links[key]; ok {
+					h.Typeflag = tar.TypeLink
+					h.Linkname = target
+					return tw.WriteHeader(h)
+				}
+				links[key] = h.Name
 			}
 
+			h.Typeflag = tar.TypeReg
+			h.Size = info.Size()
+
 			if err := tw.WriteHeader(h); err != nil {
 				return err
 			}
@@ -52,6 +87,9 @@ func Send(dir string, w io.Writer) error {
 
 			_, err = io.Copy(tw, f)
 			return err
+
+		default:
+			return fmt.Errorf("tarstream: unsupported file type %v of %s", info.Mode().Type(), rel)
 		}
 	})
 
@@ -62,39 +100,124 @@ func Send(dir string, w io.Writer) error {
 	return tw.Close()
 }
 
+// resolve returns absolute path of the entry inside dir.
+//
+// resolve rejects names that escape dir, either directly or through a symlink created earlier.
+func resolve(dir, name string) (string, error) {
+	rel := filepath.FromSlash(name)
+	if !filepath.IsLocal(rel) {
+		return "", &UnsafePathError{Name: name}
+	}
+
+	parent := dir
+	parts := strings.Split(filepath.Dir(filepath.Clean(rel)), string(filepath.Separator))
+	for _, part := range parts {
+		if part == "." {
+			continue
+		}
+
+		parent = filepath.Join(parent, part)
+		st, err := os.Lstat(parent)
+		if err == nil && st.Mode()&fs.ModeSymlink != 0 {
+			return "", &UnsafePathError{Name: name}
+		} else if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	return filepath.Join(dir, rel), nil
+}
+
+type dirAttrs struct {
+	path    string
+	mode    fs.FileMode
+	modTime time.Time
+}
+
 // Receive читает поток r и материализует содержимое потока внутри dir.
+//
+// Записи, путь которых выходит за пределы dir, приводят к ошибке *UnsafePathError.
 func Receive(dir string, r io.Reader) error {
 	tr := tar.NewReader(r)
 
+	// Directory attributes are applied at the end, since creating entries inside a directory
+	// changes its mtime and read-only directory can't be populated.
+	var dirs []dirAttrs
+
 	for {
 		h, err := tr.Next()
 		if err == io.EOF {
-			return nil
+			break
 		} else if err != nil {
 			return err
 		}
 
-		absPath := filepath.Join(dir, h.Name)
+		absPath, err := resolve(dir, h.Name)
+		if err != nil {
+			return err
+		}
 
-		if h.Typeflag == tar.TypeDir {
+		mode := fs.FileMode(h.Mode).Perm()
+
+		switch h.Typeflag {
+		case tar.TypeDir:
 			if err := os.Mkdir(absPath, 0777); err != nil {
 				return err
 			}
-		} else {
+			dirs = append(dirs, dirAttrs{path: absPath, mode: mode, modTime: h.ModTime})
+
+		case tar.TypeSymlink:
+			if err := os.Symlink(h.Linkname, absPath); err != nil {
+				return err
+			}
+
+		case tar.TypeLink:
+			target, err := resolve(dir, h.Linkname)
+			if err != nil {
+				return err
+			}
+
+			if err := os.Link(target, absPath); err != nil {
+				return err
+			}
+
+		case tar.TypeReg:
 			writeFile := func() error {
-				f, err := os.OpenFile(absPath, os.O_CREATE|os.O_WRONLY, os.FileMode(h.Mode))
+				f, err := os.OpenFile(absPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
 				if err != nil {
 					return err
 				}
 				defer f.Close()
 
-				_, err = io.Copy(f, tr)
-				return err
+				if _, err = io.Copy(f, tr); err != nil {
+					return err
+				}
+
+				return f.Chmod(mode)
 			}
 
 			if err := writeFile(); err != nil {
 				return err
 			}
+
+			if err := os.Chtimes(absPath, h.ModTime, h.ModTime); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("tarstream: unsupported entry type %q of %s", h.Typeflag, h.Name)
 		}
 	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+		if err := os.Chmod(d.path, d.mode); err != nil {
+			return err
+		}
+		if err := os.Chtimes(d.path, d.modTime, d.modTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -1,10 +1,13 @@
 package tarstream_test
 
 import (
+	"archive/tar"
 	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sys/unix"
@@ -61,6 +64,105 @@ func TestTarStream(t *testing.T) {
 	checkFile(filepath.Join(to, "b", "c", "y.txt"), []byte("yyy"), 0644)
 }
 
+func TestTarStreamAttributes(t *testing.T) {
+	from := t.TempDir()
+	to := t.TempDir()
+
+	mtime := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, os.Mkdir(filepath.Join(from, "bin"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(from, "bin", "tool"), []byte("#!/bin/sh"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(from, "secret.txt"), []byte("secret"), 0600))
+	require.NoError(t, os.Link(filepath.Join(from, "bin", "tool"), filepath.Join(from, "bin", "tool2")))
+	require.NoError(t, os.Symlink("bin/tool", filepath.Join(from, "link")))
+	require.NoError(t, os.Mkdir(filepath.Join(from, "ro"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(from, "ro", "x.txt"), []byte("x"), 0644))
+	require.NoError(t, os.Chmod(filepath.Join(from, "ro"), 0555))
+	t.Cleanup(func() { _ = os.Chmod(filepath.Join(from, "ro"), 0777) })
+
+	require.NoError(t, os.Chtimes(filepath.Join(from, "secret.txt"), mtime, mtime))
+	require.NoError(t, os.Chtimes(filepath.Join(from, "bin"), mtime, mtime))
+
+	var buf bytes.Buffer
+	require.NoError(t, tarstream.Send(from, &buf))
+	require.NoError(t, tarstream.Receive(to, &buf))
+	t.Cleanup(func() { _ = os.Chmod(filepath.Join(to, "ro"), 0777) })
+
+	st, err := os.Stat(filepath.Join(to, "secret.txt"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), st.Mode())
+	require.True(t, mtime.Equal(st.ModTime()))
+
+	st, err = os.Stat(filepath.Join(to, "bin"))
+	require.NoError(t, err)
+	require.True(t, mtime.Equal(st.ModTime()))
+
+	st, err = os.Stat(filepath.Join(to, "ro"))
+	require.NoError(t, err)
+	require.Equal(t, "dr-xr-xr-x", st.Mode().String())
+
+	target, err := os.Readlink(filepath.Join(to, "link"))
+	require.NoError(t, err)
+	require.Equal(t, "bin/tool", target)
+
+	tool, err := os.Stat(filepath.Join(to, "bin", "tool"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), tool.Mode())
+
+	tool2, err := os.Stat(filepath.Join(to, "bin", "tool2"))
+	require.NoError(t, err)
+	require.True(t, os.SameFile(tool, tool2))
+}
+
+func TestReceiveUnsafePath(t *testing.T) {
+	for _, testCase := range []struct {
+		name    string
+		headers []*tar.Header
+	}{
+		{
+			name:    "DotDot",
+			headers: []*tar.Header{{Name: "../evil.txt", Typeflag: tar.TypeReg}},
+		},
+		{
+			name:    "Absolute",
+			headers: []*tar.Header{{Name: "/tmp/evil.txt", Typeflag: tar.TypeReg}},
+		},
+		{
+			name: "ThroughSymlink",
+			headers: []*tar.Header{
+				{Name: "a", Typeflag: tar.TypeSymlink, Linkname: ".."},
+				{Name: "a/evil.txt", Typeflag: tar.TypeReg},
+			},
+		},
+		{
+			name:    "Hardlink",
+			headers: []*tar.Header{{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "../../etc/passwd"}},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			root := t.TempDir()
+			to := filepath.Join(root, "to")
+			require.NoError(t, os.Mkdir(to, 0777))
+
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for _, h := range testCase.headers {
+				h.Mode = 0644
+				require.NoError(t, tw.WriteHeader(h))
+			}
+			require.NoError(t, tw.Close())
+
+			err := tarstream.Receive(to, &buf)
+
+			var pathErr *tarstream.UnsafePathError
+			require.Truef(t, errors.As(err, &pathErr), "%v", err)
+
+			_, err = os.Stat(filepath.Join(root, "evil.txt"))
+			require.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
 func init() {
 	unix.Umask(0022)
 }
@@ -0,0 +1,252 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// JobTrace хранит время всех фаз одного джоба.
+type JobTrace struct {
+	ID     build.ID
+	Name   string
+	Worker api.WorkerID
+
+	// Scheduled и Picked записывает координатор.
+	Scheduled time.Time
+	Picked    time.Time
+
+	// Остальные фазы приходят от воркера в api.JobResult.Timings.
+	api.JobTimings
+}
+
+// Trace записывает хронологию одного билда.
+//
+// Все методы Trace concurrency safe. Методы, получившие ID неизвестного джоба, ничего не делают.
+type Trace struct {
+	mu         sync.Mutex
+	started    time.Time
+	uploadDone time.Time
+	jobs       map[build.ID]*JobTrace
+}
+
+// New создаёт трейс билда, который начался в момент started.
+func New(started time.Time, graph *build.Graph) *Trace {
+	t := &Trace{
+		started: started,
+		jobs:    make(map[build.ID]*JobTrace, len(graph.Jobs)),
+	}
+
+	for _, job := range graph.Jobs {
+		t.jobs[job.ID] = &JobTrace{ID: job.ID, Name: job.Name}
+	}
+	return t
+}
+
+// UploadDone отмечает, что клиент закончил заливать исходные файлы.
+func (t *Trace) UploadDone(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.uploadDone = now
+}
+
+// Scheduled отмечает, что джоб передан в планировщик.
+func (t *Trace) Scheduled(jobID build.ID, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if j, ok := t.jobs[jobID]; ok {
+		j.Scheduled = now
+	}
+}
+
+// Picked отмечает, что планировщик выдал джоб воркеру.
+func (t *Trace) Picked(jobID build.ID, workerID api.WorkerID, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if j, ok := t.jobs[jobID]; ok {
+		j.Worker = workerID
+		j.Picked = now
+	}
+}
+
+// Finished записывает фазы джоба, которые прислал воркер.
+func (t *Trace) Finished(result *api.JobResult) {
+	if result.Timings == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if j, ok := t.jobs[result.ID]; ok {
+		j.JobTimings = *result.Timings
+	}
+}
+
+// Jobs возвращает копию записанных фаз всех джобов.
+func (t *Trace) Jobs() []JobTrace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	jobs := make([]JobTrace, 0, len(t.jobs))
+	for _, j := range t.jobs {
+		jobs = append(jobs, *j)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].ID.String() < jobs[j].ID.String()
+	})
+	return jobs
+}
+
+// event is a single entry of the Chrome trace_event format.
+//
+// See https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type event struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat,omitempty"`
+	Ph   string         `json:"ph"`
+	TS   float64        `json:"ts"`
+	Dur  float64        `json:"dur"`
+	PID  int            `json:"pid"`
+	TID  int            `json:"tid"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+type span struct {
+	name, cat  string
+	start, end time.Time
+	args       map[string]any
+}
+
+// lanes assigns each group of spans to the first lane that is free at the start of the group,
+// so that spans on the same lane never overlap.
+type lanes struct {
+	ends []time.Time
+}
+
+func (l *lanes) assign(start, end time.Time) int {
+	for i, e := range l.ends {
+		if !start.Before(e) {
+			l.ends[i] = end
+			return i
+		}
+	}
+
+	l.ends = append(l.ends, end)
+	return len(l.ends) - 1
+}
+
+// WriteJSON пишет трейс в формате Chrome trace_event, который открывается в chrome://tracing и Perfetto.
+//
+// Координатор показывается отдельным процессом с заливкой файлов и ожиданием джобов в очереди,
+// а каждый воркер отдельным процессом, в котором джобы разложены по непересекающимся дорожкам.
+// Фазы воркера измерены по его часам, поэтому рассинхронизация часов сдвигает их относительно фаз координатора.
+func (t *Trace) WriteJSON(w io.Writer) error {
+	t.mu.Lock()
+	started := t.started
+	uploadDone := t.uploadDone
+	t.mu.Unlock()
+
+	jobs := t.Jobs()
+
+	ts := func(at time.Time) float64 {
+		return float64(at.Sub(started)) / float64(time.Microsecond)
+	}
+
+	var events []event
+	addProcess := func(pid int, name string) {
+		events = append(events, event{
+			Name: "process_name",
+			Ph:   "M",
+			PID:  pid,
+			Args: map[string]any{"name": name},
+		})
+	}
+
+	// addSpans puts spans of one job on the same lane. Phases that were not recorded are skipped.
+	addSpans := func(pid int, l *lanes, spans []span) {
+		var recorded []span
+		for _, s := range spans {
+			if !s.start.IsZero() && !s.end.IsZero() {
+				recorded = append(recorded, s)
+			}
+		}
+
+		if len(recorded) == 0 {
+			return
+		}
+
+		tid := l.assign(recorded[0].start, recorded[len(recorded)-1].end)
+		for _, s := range recorded {
+			events = append(events, event{
+				Name: s.name,
+				Cat:  s.cat,
+				Ph:   "X",
+				TS:   ts(s.start),
+				Dur:  ts(s.end) - ts(s.start),
+				PID:  pid,
+				TID:  tid,
+				Args: s.args,
+			})
+		}
+	}
+
+	// Spans must be assigned to lanes in the order of their start.
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].Scheduled.Before(jobs[j].Scheduled)
+	})
+
+	addProcess(0, "coordinator")
+	coordinatorLanes := &lanes{}
+	addSpans(0, coordinatorLanes, []span{{name: "upload sources", cat: "upload", start: started, end: uploadDone}})
+
+	for _, j := range jobs {
+		addSpans(0, coordinatorLanes, []span{{
+			name:  j.Name,
+			cat:   "queue",
+			start: j.Scheduled,
+			end:   j.Picked,
+			args:  map[string]any{"id": j.ID.String(), "worker": j.Worker.String()},
+		}})
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].Received.Before(jobs[j].Received)
+	})
+
+	workerPIDs := map[api.WorkerID]int{}
+	workerLanes := map[api.WorkerID]*lanes{}
+	for _, j := range jobs {
+		if j.Worker == "" || j.Received.IsZero() {
+			continue
+		}
+
+		pid, ok := workerPIDs[j.Worker]
+		if !ok {
+			pid = len(workerPIDs) + 1
+			workerPIDs[j.Worker] = pid
+			workerLanes[j.Worker] = &lanes{}
+			addProcess(pid, j.Worker.String())
+		}
+
+		args := map[string]any{"id": j.ID.String()}
+		addSpans(pid, workerLanes[j.Worker], []span{
+			{name: j.Name, cat: "fetch", start: j.Received, end: j.DepsFetched, args: args},
+			{name: j.Name, cat: "run", start: j.Started, end: j.Finished, args: args},
+		})
+	}
+
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []event `json:"traceEvents"`
+		DisplayTimeUnit string  `json:"displayTimeUnit"`
+	}{events, "ms"})
+}
@@ -0,0 +1,120 @@
+package trace_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/trace"
+)
+
+type event struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat"`
+	Ph   string         `json:"ph"`
+	TS   float64        `json:"ts"`
+	Dur  float64        `json:"dur"`
+	PID  int            `json:"pid"`
+	TID  int            `json:"tid"`
+	Args map[string]any `json:"args"`
+}
+
+func readEvents(t *testing.T, tr *trace.Trace) []event {
+	var buf bytes.Buffer
+	require.NoError(t, tr.WriteJSON(&buf))
+
+	var file struct {
+		TraceEvents []event `json:"traceEvents"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &file))
+	return file.TraceEvents
+}
+
+func TestTrace(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	graph := &build.Graph{Jobs: []build.Job{
+		{ID: build.ID{'a'}, Name: "a"},
+		{ID: build.ID{'b'}, Name: "b"},
+		{ID: build.ID{'c'}, Name: "c"},
+	}}
+
+	tr := trace.New(start, graph)
+	tr.UploadDone(at(10))
+
+	// a and b overlap on w0, c runs on w1 after a.
+	for i, id := range []build.ID{{'a'}, {'b'}, {'c'}} {
+		tr.Scheduled(id, at(10+i))
+	}
+
+	tr.Picked(build.ID{'a'}, "w0", at(20))
+	tr.Picked(build.ID{'b'}, "w0", at(21))
+	tr.Picked(build.ID{'c'}, "w1", at(40))
+
+	tr.Finished(&api.JobResult{ID: build.ID{'a'}, Timings: &api.JobTimings{
+		Received: at(20), DepsFetched: at(25), Started: at(25), Finished: at(30),
+	}})
+	tr.Finished(&api.JobResult{ID: build.ID{'b'}, Timings: &api.JobTimings{
+		Received: at(21), DepsFetched: at(22), Started: at(22), Finished: at(50),
+	}})
+	tr.Finished(&api.JobResult{ID: build.ID{'c'}, Timings: &api.JobTimings{
+		Received: at(40), DepsFetched: at(41), Started: at(41), Finished: at(45),
+	}})
+
+	// Unknown jobs are ignored.
+	tr.Scheduled(build.ID{'x'}, at(0))
+
+	events := readEvents(t, tr)
+
+	processes := map[int]string{}
+	spans := map[string]event{}
+	for _, e := range events {
+		switch e.Ph {
+		case "M":
+			processes[e.PID] = e.Args["name"].(string)
+		case "X":
+			spans[e.Cat+" "+e.Name] = e
+		default:
+			t.Fatalf("unexpected event %+v", e)
+		}
+	}
+
+	require.Equal(t, map[int]string{0: "coordinator", 1: "w0", 2: "w1"}, processes)
+	require.Len(t, spans, 1+3+6)
+
+	require.Equal(t, event{Name: "upload sources", Cat: "upload", Ph: "X", TS: 0, Dur: 10000, PID: 0, TID: 0}, spans["upload upload sources"])
+
+	queued := spans["queue c"]
+	require.Equal(t, float64(12000), queued.TS)
+	require.Equal(t, float64(28000), queued.Dur)
+	require.Equal(t, "w1", queued.Args["worker"])
+
+	run := spans["run b"]
+	require.Equal(t, 1, run.PID)
+	require.Equal(t, float64(22000), run.TS)
+	require.Equal(t, float64(28000), run.Dur)
+	require.Equal(t, build.ID{'b'}.String(), run.Args["id"])
+
+	// Overlapping jobs of one worker are placed on different lanes, phases of one job share a lane.
+	require.NotEqual(t, spans["run a"].TID, spans["run b"].TID)
+	require.Equal(t, spans["fetch b"].TID, spans["run b"].TID)
+	require.Equal(t, 2, spans["run c"].PID)
+}
+
+func TestTraceUnfinished(t *testing.T) {
+	start := time.Now()
+	tr := trace.New(start, &build.Graph{Jobs: []build.Job{{ID: build.ID{'a'}, Name: "a"}}})
+
+	tr.Scheduled(build.ID{'a'}, start)
+
+	// Neither upload nor the job have finished yet, there is nothing to show except the process.
+	events := readEvents(t, tr)
+	require.Len(t, events, 1)
+	require.Equal(t, "M", events[0].Ph)
+}
@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// ErrNotHermetic сообщает, что джоб произвёл не те выходы, которые объявил.
+var ErrNotHermetic = errors.New("job is not hermetic")
+
+// CheckOutputs сверяет содержимое outputDir со списком job.Outputs.
+//
+// Каждый объявленный выход должен существовать. Объявленная директория может содержать
+// произвольные файлы. Любой другой файл внутри outputDir считается необъявленным выходом.
+// Если job.Outputs пуст, проверка не выполняется.
+func CheckOutputs(job *build.Job, outputDir string) error {
+	if len(job.Outputs) == 0 {
+		return nil
+	}
+
+	var errs []error
+
+	declared := map[string]bool{}
+	parents := map[string]bool{}
+	for _, output := range job.Outputs {
+		output = path.Clean(output)
+		declared[output] = true
+
+		for dir := path.Dir(output); dir != "."; dir = path.Dir(dir) {
+			parents[dir] = true
+		}
+
+		if _, err := os.Lstat(filepath.Join(outputDir, filepath.FromSlash(output))); err != nil {
+			errs = append(errs, fmt.Errorf("%w: declared output %q is missing", ErrNotHermetic, output))
+		}
+	}
+
+	err := filepath.WalkDir(outputDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(outputDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case rel == ".", parents[rel] && d.IsDir():
+			return nil
+
+		case declared[rel]:
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+
+		default:
+			errs = append(errs, fmt.Errorf("%w: undeclared output %q", ErrNotHermetic, rel))
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+	})
+
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// StageInputs копирует в dst только файлы из job.Inputs.
+//
+// В строгом режиме воркер запускает команды джоба в директории, подготовленной StageInputs,
+// поэтому джоб, читающий необъявленные входы, падает с ошибкой отсутствия файла.
+// Файлы именно копируются: жёсткая ссылка на файл из кеша позволила бы джобу
+// изменить закешированный исходник.
+func StageInputs(job *build.Job, sourceDir, dst string) error {
+	for _, input := range job.Inputs {
+		rel := filepath.FromSlash(input)
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("input %q is outside of source dir", input)
+		}
+
+		from := filepath.Join(sourceDir, rel)
+		to := filepath.Join(dst, rel)
+
+		if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+			return err
+		}
+
+		if err := copyFile(from, to); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	st, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, st.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+
+	return dst.Close()
+}
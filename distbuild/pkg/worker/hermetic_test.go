@@ -0,0 +1,79 @@
+package worker_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/worker"
+)
+
+func writeFiles(t *testing.T, dir string, files ...string) {
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0777))
+		require.NoError(t, os.WriteFile(path, []byte(f), 0666))
+	}
+}
+
+func TestCheckOutputs(t *testing.T) {
+	job := &build.Job{Outputs: []string{"bin/a.out", "pkg"}}
+
+	for _, testCase := range []struct {
+		name  string
+		files []string
+		ok    bool
+	}{
+		{name: "Exact", files: []string{"bin/a.out", "pkg/a.a", "pkg/sub/b.a"}, ok: true},
+		{name: "Missing", files: []string{"bin/a.out"}},
+		{name: "Undeclared", files: []string{"bin/a.out", "pkg/a.a", "bin/tmp.o"}},
+		{name: "UndeclaredTopLevel", files: []string{"bin/a.out", "pkg/a.a", "log.txt"}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, testCase.files...)
+
+			err := worker.CheckOutputs(job, dir)
+			if testCase.ok {
+				require.NoError(t, err)
+			} else {
+				require.Truef(t, errors.Is(err, worker.ErrNotHermetic), "%v", err)
+			}
+		})
+	}
+
+	t.Run("NoDeclaredOutputs", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFiles(t, dir, "anything")
+		require.NoError(t, worker.CheckOutputs(&build.Job{}, dir))
+	})
+}
+
+func TestStageInputs(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeFiles(t, sourceDir, "a.go", "sub/b.go", "secret.txt")
+
+	dst := t.TempDir()
+	job := &build.Job{Inputs: []string{"a.go", "sub/b.go"}}
+	require.NoError(t, worker.StageInputs(job, sourceDir, dst))
+
+	content, err := os.ReadFile(filepath.Join(dst, "sub", "b.go"))
+	require.NoError(t, err)
+	require.Equal(t, "sub/b.go", string(content))
+
+	_, err = os.Stat(filepath.Join(dst, "secret.txt"))
+	require.True(t, os.IsNotExist(err))
+
+	// Job must not be able to modify the original file through the staged copy.
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "a.go"), []byte("modified"), 0666))
+	content, err = os.ReadFile(filepath.Join(sourceDir, "a.go"))
+	require.NoError(t, err)
+	require.Equal(t, "a.go", string(content))
+
+	job.Inputs = []string{"missing.go"}
+	require.Error(t, worker.StageInputs(job, sourceDir, t.TempDir()))
+}
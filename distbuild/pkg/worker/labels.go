@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// DefaultLabels возвращает метки, которые воркер сообщает координатору в HeartbeatRequest.Labels.
+//
+// Метки "os" и "arch" описывают платформу воркера, "go" - версию тулчейна из PATH, если он установлен.
+// Дополнительные теги можно добавить в возвращённую map.
+func DefaultLabels() map[string]string {
+	labels := map[string]string{
+		"os":   runtime.GOOS,
+		"arch": runtime.GOARCH,
+	}
+
+	if out, err := exec.Command("go", "env", "GOVERSION").Output(); err == nil {
+		if version := strings.TrimSpace(string(out)); version != "" {
+			labels["go"] = version
+		}
+	}
+
+	return labels
+}
+
+// TotalMemory возвращает объём памяти машины в байтах или 0, если его не удалось определить.
+func TotalMemory() int64 {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// MemTotal:       16303720 kB
+		fields := strings.Fields(s.Text())
+		if len(fields) == 3 && fields[0] == "MemTotal:" && fields[2] == "kB" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kb * 1024
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,22 @@
+package worker
+
+import "gitlab.com/slon/shad-go/distbuild/pkg/metrics"
+
+var (
+	jobDuration = metrics.Default.Histogram("distbuild_worker_job_duration_seconds",
+		"Time spent running commands of a job, excluding downloads.", metrics.DefaultBuckets)
+	cacheHits = metrics.Default.Counter("distbuild_worker_cache_hits_total",
+		"Jobs whose result was found in the artifact cache.")
+	cacheMisses = metrics.Default.Counter("distbuild_worker_cache_misses_total",
+		"Jobs that had to be executed.")
+	heartbeatLatency = metrics.Default.Histogram("distbuild_worker_heartbeat_latency_seconds",
+		"Round trip time of heartbeat requests.", metrics.DefaultBuckets)
+)
+
+// registerRunningJobs exports the number of running jobs of the worker.
+// Jobs of all workers in the process are summed, unregister removes this one.
+func registerRunningJobs(running *RunningJobs) (unregister func()) {
+	return metrics.Default.GaugeFunc("distbuild_worker_running_jobs", "Jobs running on the worker.", func() float64 {
+		return float64(len(running.List()))
+	})
+}
@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"io"
+	"sync"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// OutputBuffer накапливает вывод команд джоба и нарезает его на куски для HeartbeatRequest.JobOutput.
+//
+// Все методы OutputBuffer concurrency safe.
+type OutputBuffer struct {
+	id build.ID
+
+	mu             sync.Mutex
+	stdout, stderr outputStream
+}
+
+type outputStream struct {
+	data []byte
+	sent int
+}
+
+func NewOutputBuffer(id build.ID) *OutputBuffer {
+	return &OutputBuffer{id: id}
+}
+
+type outputWriter struct {
+	b      *OutputBuffer
+	stream *outputStream
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	w.b.mu.Lock()
+	defer w.b.mu.Unlock()
+
+	w.stream.data = append(w.stream.data, p...)
+	return len(p), nil
+}
+
+// Stdout возвращает writer, который нужно передать команде в качестве stdout.
+func (b *OutputBuffer) Stdout() io.Writer {
+	return outputWriter{b: b, stream: &b.stdout}
+}
+
+// Stderr возвращает writer, который нужно передать команде в качестве stderr.
+func (b *OutputBuffer) Stderr() io.Writer {
+	return outputWriter{b: b, stream: &b.stderr}
+}
+
+// Chunks возвращает вывод, который ещё не был отдан, не более maxSize байт на поток.
+//
+// Остаток вывода будет возвращён следующими вызовами Chunks.
+func (b *OutputBuffer) Chunks(maxSize int) []api.JobOutput {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var chunks []api.JobOutput
+	for _, s := range []struct {
+		name   api.OutputStream
+		stream *outputStream
+	}{
+		{api.Stdout, &b.stdout},
+		{api.Stderr, &b.stderr},
+	} {
+		pending := s.stream.data[s.stream.sent:]
+		if len(pending) == 0 {
+			continue
+		}
+		if len(pending) > maxSize {
+			pending = pending[:maxSize]
+		}
+
+		chunks = append(chunks, api.JobOutput{
+			ID:     b.id,
+			Stream: s.name,
+			Offset: int64(s.stream.sent),
+			Data:   append([]byte(nil), pending...),
+		})
+		s.stream.sent += len(pending)
+	}
+
+	return chunks
+}
+
+// Result возвращает полный вывод джоба для JobResult.
+func (b *OutputBuffer) Result() (stdout, stderr []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]byte(nil), b.stdout.data...), append([]byte(nil), b.stderr.data...)
+}
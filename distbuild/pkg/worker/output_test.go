@@ -0,0 +1,38 @@
+package worker_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/worker"
+)
+
+func TestOutputBuffer(t *testing.T) {
+	id := build.ID{'a'}
+	b := worker.NewOutputBuffer(id)
+
+	require.Empty(t, b.Chunks(4))
+
+	_, _ = fmt.Fprint(b.Stdout(), "hello world")
+	_, _ = fmt.Fprint(b.Stderr(), "err")
+
+	require.Equal(t, []api.JobOutput{
+		{ID: id, Stream: api.Stdout, Offset: 0, Data: []byte("hell")},
+		{ID: id, Stream: api.Stderr, Offset: 0, Data: []byte("err")},
+	}, b.Chunks(4))
+
+	_, _ = fmt.Fprint(b.Stdout(), "!")
+
+	require.Equal(t, []api.JobOutput{
+		{ID: id, Stream: api.Stdout, Offset: 4, Data: []byte("o world!")},
+	}, b.Chunks(1024))
+	require.Empty(t, b.Chunks(1024))
+
+	stdout, stderr := b.Result()
+	require.Equal(t, "hello world!", string(stdout))
+	require.Equal(t, "err", string(stderr))
+}
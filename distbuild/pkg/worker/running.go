@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// RunningJobs хранит джобы, которые выполняются на воркере, и позволяет их отменять.
+//
+// Один и тот же джоб может быть запущен несколько раз одновременно, например если координатор
+// перезапустил его после потери связи. Cancel отменяет все запуски, а done каждого запуска
+// убирает только его самого.
+//
+// Все методы RunningJobs concurrency safe.
+type RunningJobs struct {
+	mu   sync.Mutex
+	jobs map[build.ID][]*runningJob
+}
+
+type runningJob struct {
+	cancel context.CancelFunc
+}
+
+func NewRunningJobs() *RunningJobs {
+	return &RunningJobs{jobs: map[build.ID][]*runningJob{}}
+}
+
+// Start регистрирует джоб и возвращает контекст, который нужно передать в RunCmd.
+//
+// Контекст отменяется вызовом Cancel. После завершения джоба нужно позвать done.
+func (r *RunningJobs) Start(ctx context.Context, id build.ID) (jobCtx context.Context, done func()) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	job := &runningJob{cancel: cancel}
+
+	r.mu.Lock()
+	r.jobs[id] = append(r.jobs[id], job)
+	r.mu.Unlock()
+
+	return jobCtx, func() {
+		r.mu.Lock()
+		r.remove(id, job)
+		r.mu.Unlock()
+
+		cancel()
+	}
+}
+
+func (r *RunningJobs) remove(id build.ID, job *runningJob) {
+	jobs := r.jobs[id]
+	for i := range jobs {
+		if jobs[i] == job {
+			jobs = append(jobs[:i:i], jobs[i+1:]...)
+			break
+		}
+	}
+
+	if len(jobs) == 0 {
+		delete(r.jobs, id)
+	} else {
+		r.jobs[id] = jobs
+	}
+}
+
+// Cancel отменяет перечисленные джобы. Неизвестные и уже завершённые джобы игнорируются.
+func (r *RunningJobs) Cancel(ids []build.ID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range ids {
+		for _, job := range r.jobs[id] {
+			job.cancel()
+		}
+	}
+}
+
+// List возвращает отсортированный список джобов для HeartbeatRequest.RunningJobs.
+func (r *RunningJobs) List() []build.ID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]build.ID, 0, len(r.jobs))
+	for id := range r.jobs {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return bytes.Compare(ids[i][:], ids[j][:]) < 0
+	})
+	return ids
+}
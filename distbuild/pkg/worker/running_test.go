@@ -0,0 +1,42 @@
+package worker_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/worker"
+)
+
+func TestRunningJobs(t *testing.T) {
+	r := worker.NewRunningJobs()
+
+	ctxA, doneA := r.Start(context.Background(), build.ID{'a'})
+	ctxB, doneB := r.Start(context.Background(), build.ID{'b'})
+	defer doneB()
+
+	require.Equal(t, []build.ID{{'a'}, {'b'}}, r.List())
+
+	r.Cancel([]build.ID{{'a'}, {'c'}})
+	require.ErrorIs(t, ctxA.Err(), context.Canceled)
+	require.NoError(t, ctxB.Err())
+
+	doneA()
+	require.Equal(t, []build.ID{{'b'}}, r.List())
+}
+
+func TestRunningJobsDuplicateStart(t *testing.T) {
+	r := worker.NewRunningJobs()
+
+	_, doneFirst := r.Start(context.Background(), build.ID{'a'})
+	ctxSecond, doneSecond := r.Start(context.Background(), build.ID{'a'})
+	defer doneSecond()
+
+	doneFirst()
+	require.Equal(t, []build.ID{{'a'}}, r.List())
+
+	r.Cancel([]build.ID{{'a'}})
+	require.ErrorIs(t, ctxSecond.Err(), context.Canceled)
+}
@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// ErrLimitExceeded сообщает, что команда джоба превысила один из лимитов Limits.
+var ErrLimitExceeded = errors.New("resource limit exceeded")
+
+// LimitError описывает, какой именно лимит был превышен.
+type LimitError struct {
+	// Resource is either "cpu" or "wall".
+	Resource string
+	Limit    string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit of %s exceeded", e.Resource, e.Limit)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// Limits задаёт ограничения, с которыми запускается каждая команда джоба.
+//
+// Нулевое значение поля означает отсутствие ограничения.
+type Limits struct {
+	// CPUTime ограничивает процессорное время одного процесса команды.
+	CPUTime time.Duration
+
+	// Memory ограничивает размер адресного пространства одного процесса команды в байтах.
+	Memory int64
+
+	// Processes ограничивает число процессов пользователя, от имени которого работает воркер,
+	// и защищает машину от fork-бомб.
+	Processes int
+
+	// WallTime ограничивает время работы команды целиком.
+	WallTime time.Duration
+
+	// PassEnv перечисляет переменные окружения воркера, которые передаются команде
+	// в дополнение к Cmd.Environ. Остальное окружение воркера команде не видно.
+	PassEnv []string
+}
+
+func (l Limits) environ(cmd *build.Cmd) []string {
+	env := make([]string, 0, len(l.PassEnv)+len(cmd.Environ))
+	for _, name := range l.PassEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+
+	// Cmd.Environ goes last, so that declared variables take precedence.
+	return append(env, cmd.Environ...)
+}
+
+// RunCmd выполняет отрендеренную команду джоба.
+//
+// Команда запускается в отдельной группе процессов с очищенным окружением. При отмене ctx
+// или превышении WallTime вся группа процессов убивается. Если команда превысила лимит,
+// RunCmd возвращает *LimitError. Ненулевой код возврата ошибкой не считается.
+//
+// Упор в Memory или Processes ядро не отличает от других ошибок: системный вызов просто
+// возвращает ENOMEM или EAGAIN. Поэтому такая команда завершается обычным ненулевым кодом возврата.
+func RunCmd(ctx context.Context, cmd *build.Cmd, limits Limits, stdout, stderr io.Writer) (exitCode int, err error) {
+	if cmd.CatOutput != "" {
+		return 0, os.WriteFile(cmd.CatOutput, []byte(cmd.CatTemplate), 0666)
+	}
+
+	if len(cmd.Exec) == 0 {
+		return 0, errors.New("empty command")
+	}
+
+	runCtx := ctx
+	if limits.WallTime != 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, limits.WallTime)
+		defer cancel()
+	}
+
+	c := exec.CommandContext(runCtx, cmd.Exec[0], cmd.Exec[1:]...)
+	c.Env = limits.environ(cmd)
+	c.Dir = cmd.WorkingDirectory
+	c.Stdout = stdout
+	c.Stderr = stderr
+
+	// Background processes of the job may keep output pipes open.
+	c.WaitDelay = time.Second
+
+	if err := sandbox(c, limits); err != nil {
+		return 0, err
+	}
+
+	err = c.Run()
+	killGroup(c)
+
+	switch {
+	case ctx.Err() != nil:
+		return -1, ctx.Err()
+
+	case runCtx.Err() != nil:
+		return -1, &LimitError{Resource: "wall", Limit: limits.WallTime.String()}
+
+	case c.ProcessState == nil:
+		return -1, err
+
+	case cpuLimitExceeded(c.ProcessState, limits):
+		return -1, &LimitError{Resource: "cpu", Limit: limits.CPUTime.String()}
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) && !errors.Is(err, exec.ErrWaitDelay) {
+		return -1, err
+	}
+
+	return c.ProcessState.ExitCode(), nil
+}
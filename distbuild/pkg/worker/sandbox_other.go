@@ -0,0 +1,20 @@
+//go:build !unix
+
+package worker
+
+import (
+	"os"
+	"os/exec"
+)
+
+// sandbox is a no-op on platforms without process groups and rlimits.
+// CPU, memory and process limits are not enforced there, only WallTime is.
+func sandbox(c *exec.Cmd, limits Limits) error {
+	return nil
+}
+
+func cpuLimitExceeded(state *os.ProcessState, limits Limits) bool {
+	return limits.CPUTime != 0 && state.SystemTime()+state.UserTime() >= limits.CPUTime
+}
+
+func killGroup(c *exec.Cmd) {}
@@ -0,0 +1,190 @@
+//go:build unix
+
+package worker_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/worker"
+)
+
+func run(t *testing.T, ctx context.Context, script string, limits worker.Limits) (string, int, error) {
+	t.Helper()
+
+	cmd := &build.Cmd{
+		Exec:             []string{"/bin/sh", "-c", script},
+		Environ:          []string{"DECLARED=yes"},
+		WorkingDirectory: t.TempDir(),
+	}
+
+	var stdout bytes.Buffer
+	exitCode, err := worker.RunCmd(ctx, cmd, limits, &stdout, &stdout)
+	return stdout.String(), exitCode, err
+}
+
+func TestRunCmdExitCode(t *testing.T) {
+	out, exitCode, err := run(t, context.Background(), "echo hello; exit 3", worker.Limits{})
+	require.NoError(t, err)
+	require.Equal(t, 3, exitCode)
+	require.Equal(t, "hello\n", out)
+}
+
+func TestRunCmdEnviron(t *testing.T) {
+	t.Setenv("SECRET", "leaked")
+	t.Setenv("PASSED", "ok")
+
+	out, _, err := run(t, context.Background(), "echo $DECLARED $SECRET $PASSED", worker.Limits{PassEnv: []string{"PASSED"}})
+	require.NoError(t, err)
+	require.Equal(t, "yes ok\n", out)
+}
+
+func TestRunCmdCat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+
+	cmd := &build.Cmd{CatTemplate: "content", CatOutput: path}
+	_, err := worker.RunCmd(context.Background(), cmd, worker.Limits{}, nil, nil)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "content", string(content))
+}
+
+func TestRunCmdWallTime(t *testing.T) {
+	start := time.Now()
+	_, _, err := run(t, context.Background(), "sleep 10", worker.Limits{WallTime: 100 * time.Millisecond})
+
+	require.Truef(t, errors.Is(err, worker.ErrLimitExceeded), "%v", err)
+	require.Contains(t, err.Error(), "wall")
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestRunCmdCPUTime(t *testing.T) {
+	_, _, err := run(t, context.Background(), "while :; do :; done", worker.Limits{
+		CPUTime:  time.Second,
+		WallTime: 10 * time.Second,
+	})
+
+	require.Truef(t, errors.Is(err, worker.ErrLimitExceeded), "%v", err)
+	require.Contains(t, err.Error(), "cpu")
+}
+
+func TestRunCmdCPUTimeWithinRoundedLimit(t *testing.T) {
+	if _, err := os.Stat("/proc/uptime"); err != nil {
+		t.Skip("/proc/uptime is not available")
+	}
+
+	// Spin for 300ms of wall time. Command uses more CPU than the limit, but less than
+	// the whole second enforced by ulimit, and exits on its own.
+	script := `read s _ </proc/uptime; s=${s%.*}${s#*.}
+while read n _ </proc/uptime; n=${n%.*}${n#*.}; [ $((n - s)) -lt 30 ]; do :; done`
+
+	_, exitCode, err := run(t, context.Background(), script, worker.Limits{
+		CPUTime:  100 * time.Millisecond,
+		WallTime: 10 * time.Second,
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, 0, exitCode)
+}
+
+func TestRunCmdMemory(t *testing.T) {
+	_, exitCode, err := run(t, context.Background(), `dd bs=200M count=1 if=/dev/zero of=/dev/null`, worker.Limits{
+		Memory:   64 << 20,
+		WallTime: 10 * time.Second,
+	})
+
+	require.NoError(t, err)
+	require.NotEqual(t, 0, exitCode)
+}
+
+func TestRunCmdMemoryMessageFromSuccessfulCommand(t *testing.T) {
+	_, exitCode, err := run(t, context.Background(), `echo "out of memory" >&2`, worker.Limits{Memory: 64 << 20})
+
+	require.NoError(t, err)
+	require.Equal(t, 0, exitCode)
+}
+
+func TestRunCmdForkLoop(t *testing.T) {
+	script := "while :; do sleep 10 & done"
+	if os.Geteuid() == 0 {
+		// RLIMIT_NPROC doesn't apply to root.
+		setpriv, err := exec.LookPath("setpriv")
+		if err != nil {
+			t.Skip("setpriv is required to run fork loop as an unprivileged user")
+		}
+		script = setpriv + " --reuid=65534 --regid=65534 --clear-groups /bin/sh -c '" + script + "'"
+	}
+
+	cmd := &build.Cmd{
+		Exec:             []string{"/bin/sh", "-c", script},
+		WorkingDirectory: "/",
+	}
+
+	start := time.Now()
+	exitCode, err := worker.RunCmd(context.Background(), cmd, worker.Limits{
+		Processes: 32,
+		WallTime:  10 * time.Second,
+	}, nil, nil)
+
+	require.NoError(t, err)
+	require.NotEqual(t, 0, exitCode)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+// alive reports whether process is running. Killed process may stay a zombie,
+// if nobody reaps orphans inside the container.
+func alive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true
+	}
+
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+func TestRunCmdKillsGroupOnCancel(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for {
+			if _, err := os.Stat(pidFile); err == nil {
+				cancel()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	_, _, err := run(t, ctx, "sleep 100 & echo $! > pid.tmp && mv pid.tmp "+pidFile+"; wait", worker.Limits{})
+	require.ErrorIs(t, err, context.Canceled)
+
+	content, err := os.ReadFile(pidFile)
+	require.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return !alive(pid)
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,87 @@
+//go:build unix
+
+package worker
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// sandbox makes c start in a new process group and applies rlimits.
+//
+// Go can't set rlimits of the child directly, so the command is started through the shell
+// that calls ulimit and then replaces itself with the command.
+func sandbox(c *exec.Cmd, limits Limits) error {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.Cancel = func() error {
+		return syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+	}
+
+	var ulimit string
+	if limits.CPUTime != 0 {
+		// ulimit -t has one second granularity. Soft limit delivers SIGXCPU, which is
+		// easy to tell apart from other failures. Hard limit kills processes ignoring it.
+		seconds := cpuSeconds(limits.CPUTime)
+		ulimit += fmt.Sprintf("ulimit -S -t %d && ulimit -H -t %d && ", seconds, seconds+1)
+	}
+	if limits.Memory != 0 {
+		ulimit += fmt.Sprintf("ulimit -v %d && ", (limits.Memory+1023)/1024)
+	}
+	if limits.Processes != 0 {
+		// RLIMIT_NPROC is -u in bash and -p in dash and busybox.
+		ulimit += fmt.Sprintf("{ ulimit -u %[1]d 2>/dev/null || ulimit -p %[1]d; } && ", limits.Processes)
+	}
+
+	if ulimit == "" {
+		return nil
+	}
+
+	sh, err := exec.LookPath("/bin/sh")
+	if err != nil {
+		return err
+	}
+
+	c.Args = append([]string{sh, "-c", ulimit + `exec "$0" "$@"`, c.Path}, c.Args[1:]...)
+	c.Path = sh
+	return nil
+}
+
+// cpuSeconds rounds CPU limit up to the granularity of ulimit -t.
+func cpuSeconds(limit time.Duration) int64 {
+	return int64((limit + time.Second - 1) / time.Second)
+}
+
+// cpuLimitExceeded reports whether the process was killed by the CPU rlimit.
+//
+// Process that exited on its own is never reported, even if its CPU time is above the limit:
+// the rlimit is rounded up to whole seconds, so such process stayed within the enforced limit.
+func cpuLimitExceeded(state *os.ProcessState, limits Limits) bool {
+	if limits.CPUTime == 0 {
+		return false
+	}
+
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return false
+	}
+
+	switch status.Signal() {
+	case syscall.SIGXCPU:
+		return true
+	case syscall.SIGKILL:
+		// Hard limit is one second above the soft one. SIGKILL from anyone else comes earlier.
+		return state.SystemTime()+state.UserTime() >= time.Duration(cpuSeconds(limits.CPUTime))*time.Second
+	default:
+		return false
+	}
+}
+
+// killGroup kills processes left in the group after the command has exited.
+func killGroup(c *exec.Cmd) {
+	if c.Process != nil {
+		_ = syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+	}
+}
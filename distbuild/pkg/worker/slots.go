@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"math"
+	"sync"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// Slots учитывает ресурсы воркера, занятые выполняющимися джобами.
+//
+// Все методы Slots concurrency safe.
+type Slots struct {
+	mu   sync.Mutex
+	free build.Resources
+}
+
+// NewSlots создаёт учёт ресурсов с ёмкостью total. Нулевой total.Memory означает,
+// что объём памяти неизвестен, и память не ограничивается.
+func NewSlots(total build.Resources) *Slots {
+	if total.Memory == 0 {
+		total.Memory = math.MaxInt64
+	}
+	return &Slots{free: total}
+}
+
+// Acquire занимает ресурсы джоба, если они помещаются в свободные.
+//
+// Отрицательные ресурсы Acquire не занимает, иначе они увеличили бы свободную ёмкость.
+func (s *Slots) Acquire(r build.Resources) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.CPU < 0 || r.Memory < 0 || !r.Fits(s.free) {
+		return false
+	}
+
+	s.free = s.free.Sub(r)
+	return true
+}
+
+// Release освобождает ресурсы, занятые Acquire.
+func (s *Slots) Release(r build.Resources) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.free = s.free.Add(r)
+}
+
+// Free возвращает свободные ресурсы для HeartbeatRequest.FreeResources.
+func (s *Slots) Free() build.Resources {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.free
+}
@@ -0,0 +1,40 @@
+package worker_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/worker"
+)
+
+func TestSlots(t *testing.T) {
+	s := worker.NewSlots(build.Resources{CPU: 8, Memory: 4 << 30})
+
+	linker := build.Resources{CPU: 1, Memory: 3 << 30}
+	require.True(t, s.Acquire(linker))
+	require.False(t, s.Acquire(linker), "second linker would OOM the worker")
+	require.True(t, s.Acquire(build.DefaultResources))
+
+	require.Equal(t, build.Resources{CPU: 6, Memory: 1 << 30}, s.Free())
+
+	s.Release(linker)
+	require.True(t, s.Acquire(linker))
+}
+
+func TestSlotsUnknownMemory(t *testing.T) {
+	s := worker.NewSlots(build.Resources{CPU: 1})
+
+	require.True(t, s.Acquire(build.Resources{CPU: 1, Memory: 1 << 40}))
+	require.Equal(t, build.Resources{Memory: math.MaxInt64 - 1<<40}, s.Free())
+}
+
+func TestSlotsNegative(t *testing.T) {
+	s := worker.NewSlots(build.Resources{CPU: 1, Memory: 1 << 30})
+
+	require.False(t, s.Acquire(build.Resources{CPU: -1}))
+	require.False(t, s.Acquire(build.Resources{CPU: 1, Memory: -1}))
+	require.Equal(t, build.Resources{CPU: 1, Memory: 1 << 30}, s.Free())
+}
@@ -26,6 +26,18 @@ func New(
 	panic("implement me")
 }
 
+// NewWithHTTPClient создаёт воркер, который делает все запросы к координатору и другим воркерам через client.
+func NewWithHTTPClient(
+	workerID api.WorkerID,
+	coordinatorEndpoint string,
+	log *zap.Logger,
+	fileCache *filecache.Cache,
+	artifacts *artifact.Cache,
+	client *http.Client,
+) *Worker {
+	panic("implement me")
+}
+
 func (w *Worker) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	panic("implement me")
 }
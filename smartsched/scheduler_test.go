@@ -147,3 +147,187 @@ func TestScheduler_DependencyLocalScheduling(t *testing.T) {
 	secondPickedJob := s.PickJob(context.Background(), workerID0)
 	require.Equal(t, pendingJob2, secondPickedJob)
 }
+
+func TestScheduler_Deduplication(t *testing.T) {
+	s := newTestScheduler(t)
+	defer s.stop(t)
+
+	job := build.Job{ID: build.NewID()}
+
+	// Two builds schedule the same job.
+	pendingJob := s.ScheduleJob(&api.JobSpec{Job: job})
+	require.Same(t, pendingJob, s.ScheduleJob(&api.JobSpec{Job: job}))
+
+	s.BlockUntil(1) // only one copy of the job is waiting
+	s.Advance(config.DepsTimeout)
+
+	s.RegisterWorker(workerID0)
+	require.Same(t, pendingJob, s.PickJob(context.Background(), workerID0))
+
+	// Job is already running, third build joins it.
+	require.Same(t, pendingJob, s.ScheduleJob(&api.JobSpec{Job: job}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Nil(t, s.PickJob(ctx, workerID0), "job must not be queued twice")
+
+	result := &api.JobResult{ID: job.ID}
+	s.OnJobComplete(workerID0, job.ID, result)
+
+	select {
+	case <-pendingJob.Finished:
+		require.Equal(t, result, pendingJob.Result)
+
+	default:
+		t.Fatalf("job is not finished")
+	}
+}
+
+func TestScheduler_BuildPriority(t *testing.T) {
+	s := newTestScheduler(t)
+	defer s.stop(t)
+
+	lowJob := &api.JobSpec{BuildID: build.NewID(), Job: build.Job{ID: build.NewID()}}
+	highJob := &api.JobSpec{BuildID: build.NewID(), Priority: 1, Job: build.Job{ID: build.NewID()}}
+
+	pendingLowJob := s.ScheduleJob(lowJob)
+	pendingHighJob := s.ScheduleJob(highJob)
+
+	s.BlockUntil(2)
+	s.Advance(config.DepsTimeout) // At this point both jobs are in global queue.
+
+	s.RegisterWorker(workerID0)
+	require.Equal(t, pendingHighJob, s.PickJob(context.Background(), workerID0))
+	require.Equal(t, pendingLowJob, s.PickJob(context.Background(), workerID0))
+}
+
+func TestScheduler_PriorityBeatsLocality(t *testing.T) {
+	s := newTestScheduler(t)
+	defer s.stop(t)
+
+	depJob := &api.JobSpec{Job: build.Job{ID: build.NewID()}}
+	s.RegisterWorker(workerID0)
+	s.OnJobComplete(workerID0, depJob.ID, &api.JobResult{})
+
+	lowBuild, highBuild := build.NewID(), build.NewID()
+	localJob := &api.JobSpec{BuildID: lowBuild, Job: build.Job{ID: build.NewID(), Deps: []build.ID{depJob.ID}}}
+	otherLocalJob := &api.JobSpec{BuildID: highBuild, Priority: 1, Job: build.Job{ID: build.NewID(), Deps: []build.ID{depJob.ID}}}
+	remoteJob := &api.JobSpec{BuildID: highBuild, Priority: 1, Job: build.Job{ID: build.NewID()}}
+
+	pendingLocalJob := s.ScheduleJob(localJob)
+	pendingRemoteJob := s.ScheduleJob(remoteJob)
+
+	s.BlockUntil(2)
+	s.Advance(config.DepsTimeout) // remoteJob is in global queue, localJob is in local queue of w0.
+
+	require.Equal(t, pendingRemoteJob, s.PickJob(context.Background(), workerID0))
+	require.Equal(t, pendingLocalJob, s.PickJob(context.Background(), workerID0))
+
+	// Within the same priority worker holding dependencies wins.
+	pendingOtherLocalJob := s.ScheduleJob(otherLocalJob)
+	otherRemoteJob := &api.JobSpec{BuildID: highBuild, Priority: 1, Job: build.Job{ID: build.NewID()}}
+	pendingOtherRemoteJob := s.ScheduleJob(otherRemoteJob)
+
+	s.BlockUntil(2)
+	s.Advance(config.DepsTimeout)
+
+	require.Equal(t, pendingOtherLocalJob, s.PickJob(context.Background(), workerID0))
+	require.Equal(t, pendingOtherRemoteJob, s.PickJob(context.Background(), workerID0))
+}
+
+func TestScheduler_Requirements(t *testing.T) {
+	s := newTestScheduler(t)
+	defer s.stop(t)
+
+	const workerID1 api.WorkerID = "w1"
+
+	s.RegisterWorker(workerID0)
+	s.UpdateWorker(workerID0, map[string]string{"os": "linux"}, build.Resources{Memory: 1 << 30})
+	s.RegisterWorker(workerID1)
+	s.UpdateWorker(workerID1, map[string]string{"os": "darwin"}, build.Resources{Memory: 1 << 30})
+
+	job := &api.JobSpec{Job: build.Job{
+		ID:           build.NewID(),
+		Requirements: &build.Requirements{Labels: map[string]string{"os": "darwin"}},
+	}}
+	pendingJob := s.ScheduleJob(job)
+
+	s.BlockUntil(1)
+	s.Advance(config.DepsTimeout) // At this point job is in global queue.
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Nil(t, s.PickJob(ctx, workerID0), "linux worker can't run darwin job")
+
+	require.Equal(t, pendingJob, s.PickJob(context.Background(), workerID1))
+}
+
+func TestScheduler_ResourceFit(t *testing.T) {
+	s := newTestScheduler(t)
+	defer s.stop(t)
+
+	heavy := &build.Resources{CPU: 4, Memory: 3 << 30}
+	heavyJob0 := &api.JobSpec{Job: build.Job{ID: build.NewID(), Resources: heavy}}
+	heavyJob1 := &api.JobSpec{Job: build.Job{ID: build.NewID(), Resources: heavy}}
+	lightJob := &api.JobSpec{Job: build.Job{ID: build.NewID()}}
+
+	pendingHeavyJob0 := s.ScheduleJob(heavyJob0)
+	_ = s.ScheduleJob(heavyJob1)
+	pendingLightJob := s.ScheduleJob(lightJob)
+
+	s.BlockUntil(3)
+	s.Advance(config.DepsTimeout) // At this point all jobs are in global queue.
+
+	s.RegisterWorker(workerID0)
+
+	free := build.Resources{CPU: 8, Memory: 4 << 30}
+	require.Equal(t, pendingHeavyJob0, s.PickJobWithin(context.Background(), workerID0, free))
+	free = free.Sub(*heavy)
+
+	// Second heavy job doesn't fit into memory, light job is picked instead.
+	require.Equal(t, pendingLightJob, s.PickJobWithin(context.Background(), workerID0, free))
+	free = free.Sub(build.DefaultResources)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Nil(t, s.PickJobWithin(ctx, workerID0, free))
+}
+
+func TestScheduler_ReservationPerWorker(t *testing.T) {
+	s := newTestScheduler(t)
+	defer s.stop(t)
+
+	const workerID1 api.WorkerID = "w1"
+
+	heavyJob := &api.JobSpec{Job: build.Job{ID: build.NewID(), Resources: &build.Resources{CPU: 4}}}
+	pendingHeavyJob := s.ScheduleJob(heavyJob)
+
+	var pendingLightJobs []*scheduler.PendingJob
+	for i := 0; i < scheduler.MaxSkips+1; i++ {
+		pendingLightJobs = append(pendingLightJobs, s.ScheduleJob(&api.JobSpec{Job: build.Job{ID: build.NewID()}}))
+	}
+
+	s.BlockUntil(scheduler.MaxSkips + 2)
+	s.Advance(config.DepsTimeout) // At this point all jobs are in global queue.
+
+	total := build.Resources{CPU: 4}
+	s.RegisterWorker(workerID0)
+	s.UpdateWorker(workerID0, nil, total)
+	s.RegisterWorker(workerID1)
+	s.UpdateWorker(workerID1, nil, total)
+
+	free := build.Resources{CPU: 2}
+	for _, pendingJob := range pendingLightJobs[:scheduler.MaxSkips] {
+		require.Equal(t, pendingJob, s.PickJobWithin(context.Background(), workerID0, free))
+	}
+
+	// Heavy job was skipped too many times, w0 waits until it fits.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Nil(t, s.PickJobWithin(ctx, workerID0, free))
+
+	// Reservation of w0 doesn't stop other workers.
+	require.Equal(t, pendingLightJobs[scheduler.MaxSkips], s.PickJobWithin(context.Background(), workerID1, free))
+
+	require.Equal(t, pendingHeavyJob, s.PickJobWithin(context.Background(), workerID0, total))
+}